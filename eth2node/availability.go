@@ -0,0 +1,260 @@
+package eth2node
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type AvailabilityVerdict uint8
+
+const (
+	// Not decided yet, or none of the sampled subnets counted towards the verdict
+	AvailabilityUndetermined AvailabilityVerdict = iota
+	// All samples of the counted subnets were received before the deadline
+	AvailabilityAvailable
+	// Some of the samples of the counted subnets were missing at the deadline
+	AvailabilityUnavailable
+)
+
+func (v AvailabilityVerdict) String() string {
+	switch v {
+	case AvailabilityAvailable:
+		return "available"
+	case AvailabilityUnavailable:
+		return "unavailable"
+	default:
+		return "undetermined"
+	}
+}
+
+// SampleReceipt describes when and how a sample was received
+type SampleReceipt struct {
+	At time.Time
+	// True if the sample was pulled from a peer, instead of received on the vertical subnet
+	Pulled bool
+}
+
+// ShardBlockAvailability is the sampling result of a single shard block, as seen by this node.
+type ShardBlockAvailability struct {
+	Slot       Slot
+	Shard      Shard
+	HeaderRoot Root
+	// The samples of the block that are published on the own SLOW_INDICES and FAST_INDICES subnets,
+	// that were joined at least MIN_SUBNET_AGE_SLOTS before the slot. Only these count towards the verdict.
+	Expected []SampleIndex
+	// The valid samples of the block that were received, by sample index.
+	// May include samples that did not count towards the verdict.
+	Received map[SampleIndex]SampleReceipt
+	Verdict  AvailabilityVerdict
+	// Zero if the verdict was not decided yet
+	DecidedAt time.Time
+}
+
+// SamplingStats counts how the expected samples of decided shard blocks were received,
+// and how pulling missing samples from peers went.
+type SamplingStats struct {
+	// Expected samples that were received on the vertical subnets
+	Pushed uint64
+	// Expected samples that were missing on the vertical subnets, but pulled from peers before the deadline
+	Pulled uint64
+	// Expected samples that were still missing at the deadline
+	Missing uint64
+	// Requests to peers for missing samples
+	PullRequests uint64
+	// Requests to peers that failed, or did not return the sample
+	PullFailures uint64
+}
+
+// availabilityTracker records which samples of each known shard block were received, and when.
+type availabilityTracker struct {
+	sync.Mutex
+	blocks map[Slot]map[Root]*ShardBlockAvailability
+	stats  SamplingStats
+}
+
+func newAvailabilityTracker() *availabilityTracker {
+	return &availabilityTracker{blocks: make(map[Slot]map[Root]*ShardBlockAvailability)}
+}
+
+// addHeader starts tracking the shard block of the header, if it is not tracked already.
+func (t *availabilityTracker) addHeader(root Root, header *ShardBlockHeader) {
+	t.Lock()
+	defer t.Unlock()
+	bySlot, ok := t.blocks[header.Slot]
+	if !ok {
+		bySlot = make(map[Root]*ShardBlockAvailability)
+		t.blocks[header.Slot] = bySlot
+	}
+	if _, ok := bySlot[root]; ok {
+		return
+	}
+	bySlot[root] = &ShardBlockAvailability{
+		Slot:       header.Slot,
+		Shard:      header.Shard,
+		HeaderRoot: root,
+		Received:   make(map[SampleIndex]SampleReceipt),
+	}
+}
+
+// addSample records the first time a valid sample was received, for the given shard block.
+// Samples of unknown shard blocks are ignored.
+func (t *availabilityTracker) addSample(slot Slot, headerRoot Root, sampleIndex SampleIndex, receipt SampleReceipt) {
+	t.Lock()
+	defer t.Unlock()
+	block, ok := t.blocks[slot][headerRoot]
+	if !ok {
+		return
+	}
+	if _, ok := block.Received[sampleIndex]; !ok {
+		block.Received[sampleIndex] = receipt
+	}
+}
+
+type missingSample struct {
+	headerRoot Root
+	shard      Shard
+	index      SampleIndex
+}
+
+// missing lists the expected samples of the undecided shard blocks of the slot, that were not received yet.
+func (t *availabilityTracker) missing(slot Slot, expected func(shard Shard) []SampleIndex) (out []missingSample) {
+	t.Lock()
+	defer t.Unlock()
+	for root, block := range t.blocks[slot] {
+		if !block.DecidedAt.IsZero() {
+			continue
+		}
+		for _, i := range expected(block.Shard) {
+			if _, ok := block.Received[i]; !ok {
+				out = append(out, missingSample{headerRoot: root, shard: block.Shard, index: i})
+			}
+		}
+	}
+	return out
+}
+
+func (t *availabilityTracker) countPullRequest(success bool) {
+	t.Lock()
+	defer t.Unlock()
+	t.stats.PullRequests += 1
+	if !success {
+		t.stats.PullFailures += 1
+	}
+}
+
+func (t *availabilityTracker) samplingStats() SamplingStats {
+	t.Lock()
+	defer t.Unlock()
+	return t.stats
+}
+
+// decide sets the verdict of every undecided shard block of the slot.
+// The expected function returns the samples that count towards the verdict of a shard block of the slot.
+// Returns the number of blocks for each verdict.
+func (t *availabilityTracker) decide(slot Slot, expected func(shard Shard) []SampleIndex, at time.Time) map[AvailabilityVerdict]int {
+	t.Lock()
+	defer t.Unlock()
+	counts := make(map[AvailabilityVerdict]int)
+	for _, block := range t.blocks[slot] {
+		if !block.DecidedAt.IsZero() {
+			continue
+		}
+		block.Expected = expected(block.Shard)
+		block.DecidedAt = at
+		if len(block.Expected) == 0 {
+			block.Verdict = AvailabilityUndetermined
+		} else {
+			block.Verdict = AvailabilityAvailable
+			for _, i := range block.Expected {
+				receipt, ok := block.Received[i]
+				if !ok {
+					block.Verdict = AvailabilityUnavailable
+					t.stats.Missing += 1
+				} else if receipt.Pulled {
+					t.stats.Pulled += 1
+				} else {
+					t.stats.Pushed += 1
+				}
+			}
+		}
+		counts[block.Verdict] += 1
+	}
+	return counts
+}
+
+// report copies the results of all tracked shard blocks of the slot, ordered by shard.
+func (t *availabilityTracker) report(slot Slot) []ShardBlockAvailability {
+	t.Lock()
+	defer t.Unlock()
+	out := make([]ShardBlockAvailability, 0, len(t.blocks[slot]))
+	for _, block := range t.blocks[slot] {
+		cpy := *block
+		cpy.Expected = append([]SampleIndex(nil), block.Expected...)
+		cpy.Received = make(map[SampleIndex]SampleReceipt, len(block.Received))
+		for k, v := range block.Received {
+			cpy.Received[k] = v
+		}
+		out = append(out, cpy)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Shard != out[j].Shard {
+			return out[i].Shard < out[j].Shard
+		}
+		return string(out[i].HeaderRoot[:]) < string(out[j].HeaderRoot[:])
+	})
+	return out
+}
+
+// prune forgets about shard blocks older than the given slot
+func (t *availabilityTracker) prune(minSlot Slot) {
+	t.Lock()
+	defer t.Unlock()
+	for slot := range t.blocks {
+		if slot < minSlot {
+			delete(t.blocks, slot)
+		}
+	}
+}
+
+// expectedSamples returns the samples of a shard block that count towards its availability:
+// the samples that are published on the own vertical subnets.
+// Subnets that were joined less than MIN_SUBNET_AGE_SLOTS before the slot are ignored,
+// as the node may not have been subscribed in time to receive the sample.
+func (n *Eth2Node) expectedSamples(slot Slot, shard Shard) (out []SampleIndex) {
+	own := n.getOwnIndices()
+	for i := SampleIndex(0); i < SampleIndex(n.conf.MAX_SAMPLES_PER_SHARD_BLOCK); i++ {
+		subscribedAt, ok := own[n.conf.SampleSubnet(slot, shard, i)]
+		if !ok || subscribedAt+Slot(n.conf.MIN_SUBNET_AGE_SLOTS) > slot {
+			continue
+		}
+		out = append(out, i)
+	}
+	return out
+}
+
+// decideAvailability is called by the main loop at the AVAILABILITY_DEADLINE of each slot.
+func (n *Eth2Node) decideAvailability(slot Slot) {
+	counts := n.availability.decide(slot, func(shard Shard) []SampleIndex {
+		return n.expectedSamples(slot, shard)
+	}, time.Now())
+	n.log.With("slot", slot,
+		"available", counts[AvailabilityAvailable],
+		"unavailable", counts[AvailabilityUnavailable],
+		"undetermined", counts[AvailabilityUndetermined]).Debug("decided shard block availability")
+	for _, block := range n.availability.report(slot) {
+		n.shardChains.setVerdict(block.Shard, block.HeaderRoot, block.Verdict)
+	}
+}
+
+// SamplingStats returns the counts of pushed, pulled and missing samples of all decided shard blocks so far.
+func (n *Eth2Node) SamplingStats() SamplingStats {
+	return n.availability.samplingStats()
+}
+
+// AvailabilityReport returns the sampling results of the shard blocks of the given slot, ordered by shard.
+// Shard blocks of slots that passed the AVAILABILITY_DEADLINE have a verdict.
+// Only the most recent slots are kept.
+func (n *Eth2Node) AvailabilityReport(slot Slot) []ShardBlockAvailability {
+	return n.availability.report(slot)
+}
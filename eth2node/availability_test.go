@@ -0,0 +1,71 @@
+package eth2node
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAvailabilityTracker(t *testing.T) {
+	tracker := newAvailabilityTracker()
+	now := time.Now()
+	headers := []ShardBlockHeader{
+		{Slot: 10, Shard: 0},
+		{Slot: 10, Shard: 1},
+		{Slot: 10, Shard: 2},
+	}
+	for i := range headers {
+		tracker.addHeader(Root{byte(i + 1)}, &headers[i])
+	}
+	// shard 0 gets all its expected samples (one pulled), shard 1 misses sample 4, shard 2 has nothing expected.
+	tracker.addSample(10, Root{1}, 3, SampleReceipt{At: now})
+	tracker.addSample(10, Root{1}, 4, SampleReceipt{At: now, Pulled: true})
+	tracker.addSample(10, Root{2}, 3, SampleReceipt{At: now})
+	// unknown blocks are ignored
+	tracker.addSample(10, Root{42}, 3, SampleReceipt{At: now})
+	tracker.addSample(11, Root{1}, 3, SampleReceipt{At: now})
+
+	expected := func(shard Shard) []SampleIndex {
+		if shard == 2 {
+			return nil
+		}
+		return []SampleIndex{3, 4}
+	}
+	if missing := tracker.missing(10, expected); len(missing) != 1 || missing[0].shard != 1 || missing[0].index != 4 {
+		t.Fatalf("unexpected missing samples: %v", missing)
+	}
+	counts := tracker.decide(10, expected, now)
+	if counts[AvailabilityAvailable] != 1 || counts[AvailabilityUnavailable] != 1 || counts[AvailabilityUndetermined] != 1 {
+		t.Fatalf("unexpected verdict counts: %v", counts)
+	}
+
+	report := tracker.report(10)
+	if len(report) != 3 {
+		t.Fatalf("expected 3 blocks in report, got %d", len(report))
+	}
+	if stats := tracker.samplingStats(); stats.Pushed != 2 || stats.Pulled != 1 || stats.Missing != 1 {
+		t.Fatalf("unexpected sampling stats: %v", stats)
+	}
+	verdicts := []AvailabilityVerdict{AvailabilityAvailable, AvailabilityUnavailable, AvailabilityUndetermined}
+	for i, block := range report {
+		if block.Shard != Shard(i) {
+			t.Fatalf("report not ordered by shard: %d at %d", block.Shard, i)
+		}
+		if block.Verdict != verdicts[i] {
+			t.Errorf("shard %d: expected %s, got %s", i, verdicts[i], block.Verdict)
+		}
+	}
+
+	// samples after the verdict are recorded, but don't change it
+	tracker.addSample(10, Root{2}, 4, SampleReceipt{At: now})
+	if counts := tracker.decide(10, nil, now); len(counts) != 0 {
+		t.Fatalf("decided blocks twice: %v", counts)
+	}
+	if report := tracker.report(10); report[1].Verdict != AvailabilityUnavailable || len(report[1].Received) != 2 {
+		t.Fatalf("unexpected late sample effect: %v", report[1])
+	}
+
+	tracker.prune(11)
+	if len(tracker.report(10)) != 0 {
+		t.Fatal("expected slot 10 to be pruned")
+	}
+}
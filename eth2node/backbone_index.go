@@ -0,0 +1,263 @@
+package eth2node
+
+import (
+	"github.com/libp2p/go-libp2p-core/peer"
+	"sync"
+)
+
+// Number of slots that the backbone index keeps a view for, e.g. the current slot and a prefetched future slot.
+const backboneViews = 4
+
+type backbonePeer struct {
+	// the seed of the peer is computed once, when the peer is first added to a view
+	seeded      bool
+	seed        [32]byte
+	slowIndices uint64
+}
+
+// backboneEntry is one of the SLOW_INDICES entries of a peer,
+// the subnet is only recomputed when the rotation window of the entry changes.
+type backboneEntry struct {
+	window uint64
+	subnet VerticalIndex
+}
+
+// backboneView is the subnet -> peers mapping of the backbone at a single slot.
+type backboneView struct {
+	slot Slot
+	// the peers that changed since the last update, and need to be computed again
+	dirty map[peer.ID]struct{}
+	// peer -> entries, one for each of the SLOW_INDICES of the peer
+	entries map[peer.ID][]backboneEntry
+	// subnet -> peer -> number of entries of the peer on the subnet
+	subnets map[VerticalIndex]map[peer.ID]uint64
+	// to pick the least recently used view to update, when moving to a new slot
+	lastUsed uint64
+}
+
+func newBackboneView(slot Slot) *backboneView {
+	return &backboneView{
+		slot:    slot,
+		dirty:   make(map[peer.ID]struct{}),
+		entries: make(map[peer.ID][]backboneEntry),
+		subnets: make(map[VerticalIndex]map[peer.ID]uint64),
+	}
+}
+
+func (v *backboneView) clone() *backboneView {
+	out := &backboneView{
+		slot:    v.slot,
+		dirty:   make(map[peer.ID]struct{}, len(v.dirty)),
+		entries: make(map[peer.ID][]backboneEntry, len(v.entries)),
+		subnets: make(map[VerticalIndex]map[peer.ID]uint64, len(v.subnets)),
+	}
+	for id := range v.dirty {
+		out.dirty[id] = struct{}{}
+	}
+	for id, entries := range v.entries {
+		out.entries[id] = append([]backboneEntry(nil), entries...)
+	}
+	for subnet, peers := range v.subnets {
+		m := make(map[peer.ID]uint64, len(peers))
+		for id, count := range peers {
+			m[id] = count
+		}
+		out.subnets[subnet] = m
+	}
+	return out
+}
+
+func (v *backboneView) addEntry(id peer.ID, subnet VerticalIndex) {
+	peers, ok := v.subnets[subnet]
+	if !ok {
+		peers = make(map[peer.ID]uint64)
+		v.subnets[subnet] = peers
+	}
+	peers[id] += 1
+}
+
+func (v *backboneView) removeEntry(id peer.ID, subnet VerticalIndex) {
+	peers := v.subnets[subnet]
+	if peers[id] <= 1 {
+		delete(peers, id)
+	} else {
+		peers[id] -= 1
+	}
+	if len(peers) == 0 {
+		delete(v.subnets, subnet)
+	}
+}
+
+func (v *backboneView) removePeer(id peer.ID) {
+	for _, e := range v.entries[id] {
+		v.removeEntry(id, e.subnet)
+	}
+	delete(v.entries, id)
+}
+
+// updatePeer moves the entries of the peer to the given slot. Only the entries of which the window ticked over are
+// hashed again, the other entries stay on the same subnet.
+func (v *backboneView) updatePeer(conf *ExpandedConfig, id peer.ID, p *backbonePeer, slot Slot) {
+	if !p.seeded {
+		p.seed = conf.DasSlowPeerSeed(id)
+		p.seeded = true
+	}
+	entries, ok := v.entries[id]
+	if !ok {
+		entries = make([]backboneEntry, p.slowIndices, p.slowIndices)
+		v.entries[id] = entries
+	}
+	peerOffset := conf.DasSlowPeerSlotOffset(p.seed)
+	for i := uint64(0); i < p.slowIndices; i++ {
+		shifted := slot + peerOffset + conf.DasSlowSubnetSlotOffset(i)
+		window := uint64(shifted) / conf.SLOTS_PER_SLOW_ROTATION
+		if ok && entries[i].window == window {
+			continue
+		}
+		subnet := conf.DasSlowSubnetIndex(p.seed, shifted, i)
+		if ok {
+			v.removeEntry(id, entries[i].subnet)
+		}
+		entries[i] = backboneEntry{window: window, subnet: subnet}
+		v.addEntry(id, subnet)
+	}
+}
+
+func (v *backboneView) update(conf *ExpandedConfig, peers map[peer.ID]*backbonePeer, slot Slot) {
+	if v.slot == slot {
+		// only the changed peers need to be computed
+		for id := range v.dirty {
+			if p, ok := peers[id]; ok {
+				v.updatePeer(conf, id, p, slot)
+			}
+		}
+	} else {
+		for id, p := range peers {
+			v.updatePeer(conf, id, p, slot)
+		}
+		v.slot = slot
+	}
+	v.dirty = make(map[peer.ID]struct{})
+}
+
+// BackboneIndex maps the vertical subnets to the backbone peers that are publicly subscribed to them,
+// as defined by DasSlowSubnetIndices, for the Discovery implementations.
+//
+// Computing the public subnets of every peer for every lookup is expensive, so the index keeps views of a few slots,
+// and updates them incrementally: peers can be added and removed, and the subnet of a SLOW_INDICES entry of a peer
+// is only computed again when the rotation window of the entry ticks over.
+// Future slots can be prefetched, to prepare ahead of rotations.
+//
+// The index assumes the same rotation parameters of the config for every call.
+// The zero value is ready to use.
+type BackboneIndex struct {
+	sync.Mutex
+	peers map[peer.ID]*backbonePeer
+	views map[Slot]*backboneView
+	uses  uint64
+}
+
+// AddPeer adds a peer to the index, or updates the SLOW_INDICES count of a known peer.
+func (b *BackboneIndex) AddPeer(id peer.ID, slowIndices uint64) {
+	b.Lock()
+	defer b.Unlock()
+	if b.peers == nil {
+		b.peers = make(map[peer.ID]*backbonePeer)
+	}
+	if p, ok := b.peers[id]; ok {
+		if p.slowIndices == slowIndices {
+			return
+		}
+		p.slowIndices = slowIndices
+	} else {
+		b.peers[id] = &backbonePeer{slowIndices: slowIndices}
+	}
+	for _, v := range b.views {
+		v.removePeer(id)
+		v.dirty[id] = struct{}{}
+	}
+}
+
+// RemovePeer removes a peer from the index, if it is known.
+func (b *BackboneIndex) RemovePeer(id peer.ID) {
+	b.Lock()
+	defer b.Unlock()
+	if _, ok := b.peers[id]; !ok {
+		return
+	}
+	delete(b.peers, id)
+	for _, v := range b.views {
+		v.removePeer(id)
+	}
+}
+
+// view returns the view of the slot, after updating it.
+// A slot without a view reuses the least recently used view, or a copy of the closest view if there is space for more.
+func (b *BackboneIndex) view(conf *ExpandedConfig, slot Slot) *backboneView {
+	if b.views == nil {
+		b.views = make(map[Slot]*backboneView)
+	}
+	v, ok := b.views[slot]
+	if !ok {
+		var closest, lru *backboneView
+		for _, other := range b.views {
+			if closest == nil || slotDistance(other.slot, slot) < slotDistance(closest.slot, slot) {
+				closest = other
+			}
+			if lru == nil || other.lastUsed < lru.lastUsed {
+				lru = other
+			}
+		}
+		switch {
+		case len(b.views) >= backboneViews:
+			delete(b.views, lru.slot)
+			v = lru
+		case closest != nil:
+			v = closest.clone()
+		default:
+			v = newBackboneView(slot)
+			for id := range b.peers {
+				v.dirty[id] = struct{}{}
+			}
+		}
+		b.views[slot] = v
+	}
+	v.update(conf, b.peers, slot)
+	b.uses += 1
+	v.lastUsed = b.uses
+	return v
+}
+
+func slotDistance(a Slot, b Slot) Slot {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// Find returns the peers that are publicly subscribed to any of the given subnets at the slot.
+func (b *BackboneIndex) Find(conf *ExpandedConfig, slot Slot, subnets map[VerticalIndex]struct{}) map[VerticalIndex][]peer.ID {
+	b.Lock()
+	defer b.Unlock()
+	v := b.view(conf, slot)
+	candidates := make(map[VerticalIndex][]peer.ID, len(subnets))
+	for s := range subnets {
+		peers := v.subnets[s]
+		if len(peers) == 0 {
+			continue
+		}
+		out := make([]peer.ID, 0, len(peers))
+		for id := range peers {
+			out = append(out, id)
+		}
+		candidates[s] = out
+	}
+	return candidates
+}
+
+// Prefetch prepares the view of a future slot, so a later Find of the slot is fast.
+func (b *BackboneIndex) Prefetch(conf *ExpandedConfig, slot Slot) {
+	b.Lock()
+	defer b.Unlock()
+	b.view(conf, slot)
+}
@@ -0,0 +1,73 @@
+package eth2node
+
+import (
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"sort"
+	"testing"
+)
+
+func TestBackboneIndex(t *testing.T) {
+	conf := &Config{
+		SLOW_INDICES:                2,
+		MAX_SAMPLES_PER_SHARD_BLOCK: 4,
+		SHARD_COUNT:                 4,
+		SLOTS_PER_SLOW_ROTATION:     8,
+		SLOT_OFFSET_PER_SLOW_INDEX:  3,
+	}
+	expConf := conf.Expand()
+	subnets := make(map[VerticalIndex]struct{})
+	for i := VerticalIndex(0); i < VerticalIndex(expConf.SAMPLE_SUBNETS); i++ {
+		subnets[i] = struct{}{}
+	}
+	counts := make(map[peer.ID]uint64)
+	var index BackboneIndex
+	for i := uint64(0); i < 20; i++ {
+		id := peer.ID(fmt.Sprintf("peer %d", i))
+		counts[id] = 1 + i%4
+		index.AddPeer(id, counts[id])
+	}
+
+	check := func(slot Slot) {
+		got := index.Find(&expConf, slot, subnets)
+		for subnet := range subnets {
+			var expected []string
+			for id, count := range counts {
+				if _, ok := expConf.DasSlowSubnetIndices(id, slot, count)[subnet]; ok {
+					expected = append(expected, string(id))
+				}
+			}
+			var found []string
+			for _, id := range got[subnet] {
+				found = append(found, string(id))
+			}
+			sort.Strings(expected)
+			sort.Strings(found)
+			if fmt.Sprint(expected) != fmt.Sprint(found) {
+				t.Fatalf("slot %d subnet %d: expected %v, got %v", slot, subnet, expected, found)
+			}
+		}
+	}
+
+	// move forward through multiple rotation windows, prefetching ahead, and sometimes looking back
+	for slot := Slot(0); slot < 40; slot++ {
+		index.Prefetch(&expConf, slot+5)
+		check(slot)
+		if slot > 3 {
+			check(slot - 3)
+		}
+		switch slot {
+		case 10:
+			// remove a peer
+			index.RemovePeer("peer 3")
+			delete(counts, "peer 3")
+		case 20:
+			// change the count of a peer, and add a new super-node
+			index.AddPeer("peer 4", 7)
+			counts["peer 4"] = 7
+			index.AddPeer("super", expConf.SAMPLE_SUBNETS)
+			counts["super"] = expConf.SAMPLE_SUBNETS
+		}
+		check(slot + 5)
+	}
+}
@@ -1,6 +1,8 @@
 package eth2node
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"math"
@@ -10,6 +12,12 @@ import (
 const BYTES_PER_DATA_POINT = 31
 const BYTES_PER_FULL_POINT = 32
 
+// Like in phase 0, to allow for some clock differences between nodes when validating gossip
+const MAXIMUM_GOSSIP_CLOCK_DISPARITY = 500 * time.Millisecond
+
+// Number of slots that a sample may be late, and still be propagated on its vertical subnet.
+const SAMPLE_PROPAGATION_SLOT_RANGE = 2
+
 type Config struct {
 	// Sampling configuration
 	// ----------------------------------
@@ -29,7 +37,7 @@ type Config struct {
 	SLOTS_PER_FAST_ROTATION_MAX uint64
 
 	// How frequently a slow vertical subnet subscriptions is randomly swapped.
-	// (deterministic on peer ID, so public and predictable)
+	// (deterministic on peer ID, so public and predictable). Defaults to 2048 if zero.
 	SLOTS_PER_SLOW_ROTATION uint64
 
 	// The time for a slow vertical subscription to wait for the previous index to rotate, for stagger effect..
@@ -38,13 +46,23 @@ type Config struct {
 	// not normal, and not a benefit, nor a big negative.
 	SLOT_OFFSET_PER_SLOW_INDEX uint64
 
+	// Number of slots before a SLOW_INDICES rotation to dial backbone peers of the upcoming subnet,
+	// so the new subnet is well peered at the switch. Zero to only look for peers after the switch.
+	SLOW_SUBNET_LOOKAHEAD_SLOTS uint64
+
 	// General configuration
 	// ----------------------------------
 
 	// Number of shards
 	SHARD_COUNT uint64
-	// Number of seconds in each slot
+	// Number of seconds in each slot. Defaults to 12 if zero.
 	SECONDS_PER_SLOT uint64
+	// Number of slots in each epoch. Defaults to 32 if zero.
+	SLOTS_PER_EPOCH uint64
+	// Number of epochs that shard committees stay the same, before rotating to new committees. Defaults to 256 if zero.
+	SHARD_COMMITTEE_PERIOD uint64
+	// Number of slots before the start of a committee period to join the horizontal subnets of the new committees.
+	HORZ_SUBNET_LOOKAHEAD_SLOTS uint64
 
 	// Number of active validators
 	VALIDATOR_COUNT uint64
@@ -77,6 +95,37 @@ type Config struct {
 	GOSSIP_GLOBAL_SCORE_PARAMS       *pubsub.PeerScoreParams
 	GOSSIP_GLOBAL_SCORE_THRESHOLDS   *pubsub.PeerScoreThresholds
 
+	// Which samples to publish on vertical subnets, after receiving a shard block on a horizontal subnet.
+	REPUBLISH_POLICY RepublishPolicy
+
+	// Time into the slot at which the availability of the shard blocks of the slot is decided.
+	// Must be less than a slot. Defaults to 2/3 of a slot if zero.
+	AVAILABILITY_DEADLINE time.Duration
+	// Time into the slot at which samples that are still missing are pulled from backbone peers.
+	// Must be before the AVAILABILITY_DEADLINE. Defaults to half of the AVAILABILITY_DEADLINE if zero.
+	PULL_DEADLINE time.Duration
+	// Number of backbone peers to request a missing sample from, in parallel.
+	PULL_PEERS uint64
+	// Vertical subnets joined less than this number of slots ago don't count towards the availability of a block.
+	MIN_SUBNET_AGE_SLOTS uint64
+
+	// Number of slots to keep the samples of the vertical subnets for, to serve them to peers.
+	SAMPLE_STORE_RETENTION_SLOTS uint64
+	// Directory to store samples in. If empty, samples are kept in memory.
+	SAMPLE_STORE_DIR string
+
+	// Fraction of the samples of each shard block that a repairer listens for, see Eth2Node.EnableRepairer.
+	// Should be more than half, to be able to recover the shard block data.
+	REPAIR_FRACTION float64
+	// Time to wait, after receiving enough samples to recover a shard block, before rebuilding the missing samples.
+	REPAIR_DELAY time.Duration
+
+	// Skip the verification of shard block and header signatures, to reduce the CPU cost of large benchmark runs.
+	DISABLE_SIGNATURE_VERIFICATION bool
+
+	// Path to the Kate trusted setup file. If empty, an insecure deterministic test setup is used.
+	TRUSTED_SETUP_PATH string
+
 	// Network settings
 	ENABLE_NAT                 bool
 	DISABLE_TRANSPORT_SECURITY bool
@@ -112,13 +161,71 @@ func (c *Config) SlotNow() (slot Slot, preGenesis bool) {
 	return c.SlotWithOffset(time.Now(), 0)
 }
 
+// SlotToEpoch returns the epoch of the slot
+func (c *Config) SlotToEpoch(slot Slot) Epoch {
+	return Epoch(uint64(slot) / c.SLOTS_PER_EPOCH)
+}
+
+// CommitteePeriod returns the shard committee period of the slot
+func (c *Config) CommitteePeriod(slot Slot) uint64 {
+	return uint64(c.SlotToEpoch(slot)) / c.SHARD_COMMITTEE_PERIOD
+}
+
+// slotStart returns the time at which the given slot starts
+func (c *Config) slotStart(slot Slot) time.Time {
+	return time.Unix(int64(c.GENESIS_TIME+uint64(slot)*c.SECONDS_PER_SLOT), 0)
+}
+
+// currentSlotRange returns the lowest and highest slot that may be current at time t,
+// given the MAXIMUM_GOSSIP_CLOCK_DISPARITY. Before genesis, slot 0 is used.
+func (c *Config) currentSlotRange(t time.Time) (lo Slot, hi Slot) {
+	lo, preGenesis := c.SlotWithOffset(t, -MAXIMUM_GOSSIP_CLOCK_DISPARITY)
+	if preGenesis {
+		lo = 0
+	}
+	hi, preGenesis = c.SlotWithOffset(t, MAXIMUM_GOSSIP_CLOCK_DISPARITY)
+	if preGenesis {
+		hi = 0
+	}
+	return lo, hi
+}
+
+// Expand validates the config, fills in the defaults of optional zero values, and computes the derived values.
 func (c *Config) Expand() ExpandedConfig {
 	subnets := c.MAX_SAMPLES_PER_SHARD_BLOCK * c.SHARD_COUNT
 	if c.FAST_INDICES+c.SLOW_INDICES > subnets {
 		panic("invalid configuration! Need FAST_INDICES + SLOW_INDICES <= subnets")
 	}
+	conf := *c
+	if conf.SLOTS_PER_SLOW_ROTATION == 0 {
+		conf.SLOTS_PER_SLOW_ROTATION = 2048
+	}
+	// like phase 0
+	if conf.SLOTS_PER_EPOCH == 0 {
+		conf.SLOTS_PER_EPOCH = 32
+	}
+	// like phase 1
+	if conf.SHARD_COMMITTEE_PERIOD == 0 {
+		conf.SHARD_COMMITTEE_PERIOD = 256
+	}
+	if conf.SECONDS_PER_SLOT == 0 {
+		conf.SECONDS_PER_SLOT = 12
+	}
+	slotDuration := time.Second * time.Duration(conf.SECONDS_PER_SLOT)
+	if conf.AVAILABILITY_DEADLINE == 0 {
+		conf.AVAILABILITY_DEADLINE = slotDuration * 2 / 3
+	}
+	if conf.AVAILABILITY_DEADLINE < 0 || conf.AVAILABILITY_DEADLINE >= slotDuration {
+		panic("invalid configuration! Need 0 < AVAILABILITY_DEADLINE < slot duration")
+	}
+	if conf.PULL_DEADLINE == 0 {
+		conf.PULL_DEADLINE = conf.AVAILABILITY_DEADLINE / 2
+	}
+	if conf.PULL_DEADLINE <= 0 || conf.PULL_DEADLINE >= conf.AVAILABILITY_DEADLINE {
+		panic("invalid configuration! Need 0 < PULL_DEADLINE < AVAILABILITY_DEADLINE")
+	}
 	return ExpandedConfig{
-		Config:         *c,
+		Config:         conf,
 		SAMPLE_SUBNETS: subnets,
 		MAX_DATA_SIZE:  BYTES_PER_DATA_POINT * c.POINTS_PER_SAMPLE * c.MAX_SAMPLES_PER_SHARD_BLOCK / 2,
 	}
@@ -134,14 +241,44 @@ type ExpandedConfig struct {
 	MAX_DATA_SIZE uint64
 }
 
+// SampleSubnet returns the vertical subnet that the sample of the given shard block is published on:
+// hash(sample_index, shard, slot) % SAMPLE_SUBNETS, to spread the samples of all shards over all subnets.
+func (conf *ExpandedConfig) SampleSubnet(slot Slot, shard Shard, sampleIndex SampleIndex) VerticalIndex {
+	var buf [24]byte
+	binary.LittleEndian.PutUint64(buf[0:8], uint64(sampleIndex))
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(shard))
+	binary.LittleEndian.PutUint64(buf[16:24], uint64(slot))
+	h := sha256.Sum256(buf[:])
+	return VerticalIndex(binary.LittleEndian.Uint64(h[:8]) % conf.SAMPLE_SUBNETS)
+}
+
+// SubnetSamples is the inverse of SampleSubnet: it returns the indices of the samples of the given shard block
+// that are published on the given vertical subnet. Multiple samples of the same block may share a subnet.
+func (conf *ExpandedConfig) SubnetSamples(slot Slot, shard Shard, subnet VerticalIndex) (out []SampleIndex) {
+	for i := SampleIndex(0); i < SampleIndex(conf.MAX_SAMPLES_PER_SHARD_BLOCK); i++ {
+		if conf.SampleSubnet(slot, shard, i) == subnet {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// KateSetup loads the configured trusted setup, or creates the insecure test setup if none is configured.
+func (conf *ExpandedConfig) KateSetup() (*KateSetup, error) {
+	if conf.TRUSTED_SETUP_PATH != "" {
+		return LoadKateSetup(conf.TRUSTED_SETUP_PATH)
+	}
+	return InsecureKateSetup(insecureKateSecret, conf.MAX_SAMPLES_PER_SHARD_BLOCK*conf.POINTS_PER_SAMPLE, conf.POINTS_PER_SAMPLE+1), nil
+}
+
 func (conf *ExpandedConfig) ShardHeadersTopic() string {
-	return fmt.Sprintf("/eth2/%x/shard_headers/ssz", conf.ForkDigest[:])
+	return fmt.Sprintf("/eth2/%x/shard_headers/ssz_snappy", conf.ForkDigest[:])
 }
 
 func (conf *ExpandedConfig) VertTopic(i VerticalIndex) string {
-	return fmt.Sprintf("/eth2/%x/das_vert_%d/ssz", conf.ForkDigest[:], i)
+	return fmt.Sprintf("/eth2/%x/das_vert_%d/ssz_snappy", conf.ForkDigest[:], i)
 }
 
 func (conf *ExpandedConfig) HorzTopic(i Shard) string {
-	return fmt.Sprintf("/eth2/%x/das_horz_%d/ssz", conf.ForkDigest[:], i)
+	return fmt.Sprintf("/eth2/%x/das_horz_%d/ssz_snappy", conf.ForkDigest[:], i)
 }
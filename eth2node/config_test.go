@@ -0,0 +1,44 @@
+package eth2node
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpandDefaults(t *testing.T) {
+	conf := (&Config{SHARD_COUNT: 4, MAX_SAMPLES_PER_SHARD_BLOCK: 16}).Expand()
+	if conf.SLOTS_PER_EPOCH != 32 {
+		t.Fatalf("expected default SLOTS_PER_EPOCH, got %d", conf.SLOTS_PER_EPOCH)
+	}
+	if conf.SLOTS_PER_SLOW_ROTATION != 2048 {
+		t.Fatalf("expected default SLOTS_PER_SLOW_ROTATION, got %d", conf.SLOTS_PER_SLOW_ROTATION)
+	}
+	if conf.SHARD_COMMITTEE_PERIOD != 256 {
+		t.Fatalf("expected default SHARD_COMMITTEE_PERIOD, got %d", conf.SHARD_COMMITTEE_PERIOD)
+	}
+	if conf.SECONDS_PER_SLOT != 12 || conf.AVAILABILITY_DEADLINE != 8*time.Second {
+		t.Fatalf("expected default slot duration and deadline, got %d seconds and %s", conf.SECONDS_PER_SLOT, conf.AVAILABILITY_DEADLINE)
+	}
+	if conf.PULL_DEADLINE != 4*time.Second {
+		t.Fatalf("expected default pull deadline, got %s", conf.PULL_DEADLINE)
+	}
+	conf = (&Config{SHARD_COUNT: 4, MAX_SAMPLES_PER_SHARD_BLOCK: 16, SLOTS_PER_EPOCH: 8, SHARD_COMMITTEE_PERIOD: 1}).Expand()
+	if conf.SLOTS_PER_EPOCH != 8 || conf.SHARD_COMMITTEE_PERIOD != 1 {
+		t.Fatalf("expected configured SLOTS_PER_EPOCH and SHARD_COMMITTEE_PERIOD, got %d and %d", conf.SLOTS_PER_EPOCH, conf.SHARD_COMMITTEE_PERIOD)
+	}
+}
+
+func TestExpandInvalidDeadlines(t *testing.T) {
+	expectPanic := func(name string, conf *Config) {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("%s: expected invalid configuration", name)
+			}
+		}()
+		conf.Expand()
+	}
+	expectPanic("availability after slot", &Config{SECONDS_PER_SLOT: 6, AVAILABILITY_DEADLINE: 6 * time.Second})
+	expectPanic("negative availability", &Config{AVAILABILITY_DEADLINE: -time.Second})
+	expectPanic("pull after availability", &Config{AVAILABILITY_DEADLINE: 4 * time.Second, PULL_DEADLINE: 5 * time.Second})
+	expectPanic("pull at availability", &Config{AVAILABILITY_DEADLINE: 4 * time.Second, PULL_DEADLINE: 4 * time.Second})
+}
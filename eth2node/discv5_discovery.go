@@ -0,0 +1,272 @@
+package eth2node
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"fmt"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ENR entry with the fork of the node, nodes of other forks are ignored.
+// Like phase 0, the value is the SSZ encoding of the ENRForkID container.
+// This prototype does not schedule forks: the next fork version is zero, and the next fork epoch is FAR_FUTURE_EPOCH.
+type enrForkID struct {
+	ForkDigest      [4]byte
+	NextForkVersion [4]byte
+	NextForkEpoch   Epoch
+}
+
+func (enrForkID) ENRKey() string { return "eth2" }
+
+const enrForkIDSize = 4 + 4 + 8
+
+func (f *enrForkID) EncodeRLP(w io.Writer) error {
+	var buf [enrForkIDSize]byte
+	copy(buf[0:4], f.ForkDigest[:])
+	copy(buf[4:8], f.NextForkVersion[:])
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(f.NextForkEpoch))
+	return rlp.Encode(w, buf[:])
+}
+
+func (f *enrForkID) DecodeRLP(s *rlp.Stream) error {
+	buf, err := s.Bytes()
+	if err != nil {
+		return err
+	}
+	if len(buf) != enrForkIDSize {
+		return fmt.Errorf("expected %d bytes ENRForkID, got %d", enrForkIDSize, len(buf))
+	}
+	copy(f.ForkDigest[:], buf[0:4])
+	copy(f.NextForkVersion[:], buf[4:8])
+	f.NextForkEpoch = Epoch(binary.LittleEndian.Uint64(buf[8:16]))
+	return nil
+}
+
+// ENR entry with the DAS participation of the node
+type enrDAS struct {
+	// True if the node is on the vertical subnets: part of the backbone of the DAS subnets
+	SubnetUser bool
+	// The number of slow vertical subnets of the node: the public part, see DasSlowSubnetIndices
+	SlowIndices uint64
+}
+
+func (enrDAS) ENRKey() string { return "das" }
+
+type discV5Peer struct {
+	node        *enode.Node
+	slowIndices uint64
+	// last time the node was found, or responded to a liveness check
+	lastSeen time.Time
+}
+
+// Peers that were not seen for this long are checked for liveness, and forgotten if they do not respond.
+const discV5PeerStaleAfter = time.Minute * 5
+
+// Interval to check for stale peers
+const discV5LivenessInterval = time.Minute
+
+// DiscV5 is a Discovery that finds the backbone of the DAS subnets with discv5.
+// The ENR of the node advertises the fork, and the DAS participation of the node.
+// The libp2p identity of the node must be the discv5 key, see Identity.
+type DiscV5 struct {
+	sync.RWMutex
+	forkDigest [4]byte
+	key        *ecdsa.PrivateKey
+	local      *enode.LocalNode
+	udp        *discover.UDPv5
+	// all discovered peers on the same fork, that participate in DAS
+	peers map[peer.ID]*discV5Peer
+	// the public subnets of the discovered peers
+	index BackboneIndex
+}
+
+// NewDiscV5 starts a discv5 node on the given UDP address, and advertises the given TCP port for libp2p.
+// The UDP port may be 0 to pick any available port.
+func NewDiscV5(conf *Config, key *ecdsa.PrivateKey, ip net.IP, udpPort uint16, tcpPort uint16, bootnodes []*enode.Node) (*DiscV5, error) {
+	db, err := enode.OpenDB("") // in-memory
+	if err != nil {
+		return nil, fmt.Errorf("failed to open node db: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip, Port: int(udpPort)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on udp: %v", err)
+	}
+	local := enode.NewLocalNode(db, key)
+	local.SetStaticIP(ip)
+	local.SetFallbackUDP(conn.LocalAddr().(*net.UDPAddr).Port)
+	local.Set(enr.TCP(tcpPort))
+	local.Set(&enrForkID{ForkDigest: conf.ForkDigest, NextForkEpoch: beacon.FAR_FUTURE_EPOCH})
+	local.Set(&enrDAS{SubnetUser: true, SlowIndices: conf.SLOW_INDICES})
+	udp, err := discover.ListenV5(conn, local, discover.Config{PrivateKey: key, Bootnodes: bootnodes})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start discv5: %v", err)
+	}
+	return &DiscV5{
+		forkDigest: conf.ForkDigest,
+		key:        key,
+		local:      local,
+		udp:        udp,
+		peers:      make(map[peer.ID]*discV5Peer),
+	}, nil
+}
+
+// Identity is the libp2p identity of the node, the same key as the discv5 key.
+func (d *DiscV5) Identity() crypto.PrivKey {
+	priv, err := crypto.UnmarshalSecp256k1PrivateKey(ethcrypto.FromECDSA(d.key))
+	if err != nil {
+		panic(fmt.Errorf("invalid discv5 key: %v", err))
+	}
+	return priv
+}
+
+// Self returns the current record of the local node, to use as bootnode for other nodes.
+func (d *DiscV5) Self() *enode.Node {
+	return d.local.Node()
+}
+
+// Run keeps looking up random nodes, and tracks those that participate in DAS, until the context is done.
+// Peers that go stale are checked for liveness, and removed if they are gone.
+func (d *DiscV5) Run(ctx context.Context) {
+	iter := d.udp.RandomNodes()
+	go func() {
+		ticker := time.NewTicker(discV5LivenessInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.checkLiveness(time.Now().Add(-discV5PeerStaleAfter))
+			case <-ctx.Done():
+				iter.Close()
+				return
+			}
+		}
+	}()
+	for iter.Next() {
+		d.addNode(iter.Node())
+	}
+}
+
+// checkLiveness pings the peers that were last seen before the given time,
+// and removes the peers that do not respond, also from the backbone index.
+func (d *DiscV5) checkLiveness(staleBefore time.Time) {
+	stale := make(map[peer.ID]*enode.Node)
+	d.RLock()
+	for id, p := range d.peers {
+		if p.lastSeen.Before(staleBefore) {
+			stale[id] = p.node
+		}
+	}
+	d.RUnlock()
+	for id, node := range stale {
+		err := d.udp.Ping(node)
+		d.Lock()
+		// the peer may have been updated in the meantime
+		if p, ok := d.peers[id]; ok && p.lastSeen.Before(staleBefore) {
+			if err != nil {
+				delete(d.peers, id)
+				d.index.RemovePeer(id)
+			} else {
+				p.lastSeen = time.Now()
+			}
+		}
+		d.Unlock()
+	}
+}
+
+func (d *DiscV5) addNode(node *enode.Node) {
+	var forkID enrForkID
+	if err := node.Load(&forkID); err != nil || forkID.ForkDigest != d.forkDigest {
+		return
+	}
+	var das enrDAS
+	if err := node.Load(&das); err != nil || !das.SubnetUser {
+		return
+	}
+	if node.TCP() == 0 {
+		return
+	}
+	id, err := enodePeerID(node)
+	if err != nil {
+		return
+	}
+	d.Lock()
+	defer d.Unlock()
+	if prev, ok := d.peers[id]; ok && prev.node.Seq() >= node.Seq() {
+		prev.lastSeen = time.Now()
+		return
+	}
+	d.peers[id] = &discV5Peer{node: node, slowIndices: das.SlowIndices, lastSeen: time.Now()}
+	d.index.AddPeer(id, das.SlowIndices)
+}
+
+// enodePeerID is the libp2p peer ID of the node, derived from the secp256k1 key of the node record.
+func enodePeerID(node *enode.Node) (peer.ID, error) {
+	pub, err := crypto.UnmarshalSecp256k1PublicKey(ethcrypto.CompressPubkey(node.Pubkey()))
+	if err != nil {
+		return "", err
+	}
+	return peer.IDFromPublicKey(pub)
+}
+
+// FindPublic filters the discovered nodes by their public slow subnets,
+// computed with the SLOW_INDICES that each node advertises in its ENR.
+func (d *DiscV5) FindPublic(conf *ExpandedConfig, slot Slot, subnets map[VerticalIndex]struct{}) map[VerticalIndex][]peer.ID {
+	return d.index.Find(conf, slot, subnets)
+}
+
+func (d *DiscV5) PrefetchPublic(conf *ExpandedConfig, slot Slot) {
+	d.index.Prefetch(conf, slot)
+}
+
+// SlowIndices returns the SLOW_INDICES count that the peer advertises in its ENR.
+func (d *DiscV5) SlowIndices(id peer.ID) (count uint64, ok bool) {
+	d.RLock()
+	defer d.RUnlock()
+	if p, ok := d.peers[id]; ok {
+		return p.slowIndices, true
+	}
+	return 0, false
+}
+
+// FindCommitteePeers always returns nil: the validators of a node are not advertised in the ENR.
+func (d *DiscV5) FindCommitteePeers(committee []ValidatorIndex) []peer.ID {
+	return nil
+}
+
+// Get addrs of a peer, may be nil if the peer is unknown.
+func (d *DiscV5) Addrs(id peer.ID) []ma.Multiaddr {
+	d.RLock()
+	p, ok := d.peers[id]
+	d.RUnlock()
+	if !ok {
+		return nil
+	}
+	ipScheme := "ip4"
+	if p.node.IP().To4() == nil {
+		ipScheme = "ip6"
+	}
+	addr, err := ma.NewMultiaddr(fmt.Sprintf("/%s/%s/tcp/%d", ipScheme, p.node.IP().String(), p.node.TCP()))
+	if err != nil {
+		return nil
+	}
+	return []ma.Multiaddr{addr}
+}
+
+// Close stops the discv5 node
+func (d *DiscV5) Close() {
+	d.udp.Close()
+}
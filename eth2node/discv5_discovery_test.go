@@ -0,0 +1,150 @@
+package eth2node
+
+import (
+	"context"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDiscV5(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conf := &Config{SLOW_INDICES: 2, MAX_SAMPLES_PER_SHARD_BLOCK: 4, SHARD_COUNT: 4, SLOTS_PER_SLOW_ROTATION: 8, ForkDigest: [4]byte{1, 2, 3, 4}}
+	otherFork := *conf
+	otherFork.ForkDigest = [4]byte{5, 6, 7, 8}
+
+	nodeCount := 16
+	var discs []*DiscV5
+	var bootnodes []*enode.Node
+	for i := 0; i <= nodeCount; i++ {
+		key, err := ethcrypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := conf
+		if i == nodeCount { // the last node is on a different fork, and should not be found
+			c = &otherFork
+		}
+		d, err := NewDiscV5(c, key, net.IPv4(127, 0, 0, 1), 0, uint16(9000+i), bootnodes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer d.Close()
+		if i == 0 {
+			bootnodes = []*enode.Node{d.Self()}
+		}
+		discs = append(discs, d)
+		go d.Run(ctx)
+	}
+	otherID, err := enodePeerID(discs[nodeCount].Self())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// wait for the first node to find all other nodes of the same fork (excl. itself)
+	deadline := time.Now().Add(time.Second * 20)
+	for {
+		discs[0].RLock()
+		found := len(discs[0].peers)
+		_, foundOther := discs[0].peers[otherID]
+		discs[0].RUnlock()
+		if foundOther {
+			t.Fatal("found node of other fork")
+		}
+		if found >= nodeCount-1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("only found %d out of %d nodes", found, nodeCount-1)
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	expConf := conf.Expand()
+	subnets := make(map[VerticalIndex]struct{})
+	for i := VerticalIndex(0); i < VerticalIndex(expConf.SAMPLE_SUBNETS); i++ {
+		subnets[i] = struct{}{}
+	}
+	backbone := discs[0].FindPublic(&expConf, 0, subnets)
+	total := 0
+	for subnet, ids := range backbone {
+		for _, id := range ids {
+			if _, ok := expConf.DasSlowSubnetIndices(id, 0, conf.SLOW_INDICES)[subnet]; !ok {
+				t.Fatalf("peer %s is not on subnet %d", id, subnet)
+			}
+			if len(discs[0].Addrs(id)) != 1 {
+				t.Fatalf("expected an address for peer %s", id)
+			}
+		}
+		total += len(ids)
+	}
+	if total == 0 {
+		t.Fatal("expected to find backbone peers")
+	}
+
+	// peers that are gone are removed after a liveness check, also from the backbone index.
+	// A separate node, that does not run lookups, to not find the closed node again.
+	key, err := ethcrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker, err := NewDiscV5(conf, key, net.IPv4(127, 0, 0, 1), 0, 9100, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer checker.Close()
+	gone, live := discs[1].Self(), discs[2].Self()
+	checker.addNode(gone)
+	checker.addNode(live)
+	goneID, err := enodePeerID(gone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	discs[1].Close()
+	checker.checkLiveness(time.Now())
+	checker.RLock()
+	_, foundGone := checker.peers[goneID]
+	remaining := len(checker.peers)
+	checker.RUnlock()
+	if foundGone {
+		t.Fatal("expected closed node to be removed")
+	}
+	if remaining != 1 {
+		t.Fatal("expected live node to stay")
+	}
+	for subnet, ids := range checker.FindPublic(&expConf, 0, subnets) {
+		for _, id := range ids {
+			if id == goneID {
+				t.Fatalf("closed node still in backbone of subnet %d", subnet)
+			}
+		}
+	}
+}
+
+func TestENRForkID(t *testing.T) {
+	f := &enrForkID{ForkDigest: [4]byte{1, 2, 3, 4}, NextForkEpoch: beacon.FAR_FUTURE_EPOCH}
+	data, err := rlp.EncodeToBytes(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a RLP byte string, with the 16 bytes of the SSZ encoded ENRForkID
+	expected := []byte{0x80 + 16, 1, 2, 3, 4, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	if string(data) != string(expected) {
+		t.Fatalf("unexpected encoding: %x", data)
+	}
+	var decoded enrForkID
+	if err := rlp.DecodeBytes(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != *f {
+		t.Fatalf("decoded %v, expected %v", decoded, f)
+	}
+	if err := rlp.DecodeBytes([]byte{0x80 + 4, 1, 2, 3, 4}, &decoded); err == nil {
+		t.Fatal("expected error for a plain fork digest")
+	}
+}
@@ -0,0 +1,55 @@
+package eth2node
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/golang/snappy"
+	pubsub_pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+// Like phase 0: the message-id domains, for messages with valid and invalid snappy compression.
+var MESSAGE_DOMAIN_INVALID_SNAPPY = [4]byte{0x00, 0x00, 0x00, 0x00}
+var MESSAGE_DOMAIN_VALID_SNAPPY = [4]byte{0x01, 0x00, 0x00, 0x00}
+
+// Maximum byte length of the decompressed data of any gossip message.
+// Larger than the phase 0 GOSSIP_MAX_SIZE, to fit a shard block with the maximum amount of data.
+const GOSSIP_MAX_SIZE = 2 << 20
+
+// encodeGossip compresses SSZ encoded data with snappy block compression, for publishing on a ssz_snappy topic.
+func encodeGossip(data []byte) []byte {
+	return snappy.Encode(nil, data)
+}
+
+// decodeGossip decompresses the data of a ssz_snappy gossip message.
+// The decompressed length is checked against the limit before decompressing.
+func decodeGossip(data []byte, maxLength uint64) ([]byte, error) {
+	length, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read decompressed length: %w", err)
+	}
+	if uint64(length) > maxLength {
+		return nil, fmt.Errorf("decompressed length %d exceeds limit %d", length, maxLength)
+	}
+	out, err := snappy.Decode(nil, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+	return out, nil
+}
+
+// MsgIDFunction computes the message-id like phase 0:
+// the hash of the decompressed data, domain separated from the hash of messages with invalid compression.
+func MsgIDFunction(pmsg *pubsub_pb.Message) string {
+	h := sha256.New()
+	// never errors, see crypto/sha256 Go doc
+	if data, err := decodeGossip(pmsg.Data, GOSSIP_MAX_SIZE); err == nil {
+		_, _ = h.Write(MESSAGE_DOMAIN_VALID_SNAPPY[:])
+		_, _ = h.Write(data)
+	} else {
+		_, _ = h.Write(MESSAGE_DOMAIN_INVALID_SNAPPY[:])
+		_, _ = h.Write(pmsg.Data)
+	}
+	id := h.Sum(nil)[:20]
+	return base64.URLEncoding.EncodeToString(id)
+}
@@ -0,0 +1,40 @@
+package eth2node
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	pubsub_pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"testing"
+)
+
+func TestGossipEncoding(t *testing.T) {
+	data := bytes.Repeat([]byte("sample"), 100)
+	enc := encodeGossip(data)
+	dec, err := decodeGossip(enc, uint64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dec, data) {
+		t.Fatal("decoded data does not match")
+	}
+	if _, err := decodeGossip(enc, uint64(len(data)-1)); err == nil {
+		t.Fatal("expected decompressed length limit to be enforced")
+	}
+}
+
+func TestMsgIDFunction(t *testing.T) {
+	data := []byte("hello")
+	msgID := func(domain [4]byte, data []byte) string {
+		h := sha256.Sum256(append(domain[:], data...))
+		return base64.URLEncoding.EncodeToString(h[:20])
+	}
+	if got, expected := MsgIDFunction(&pubsub_pb.Message{Data: encodeGossip(data)}), msgID(MESSAGE_DOMAIN_VALID_SNAPPY, data); got != expected {
+		t.Fatalf("got valid snappy msg id %s, expected %s", got, expected)
+	}
+	// not snappy compressed
+	invalid := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	if got, expected := MsgIDFunction(&pubsub_pb.Message{Data: invalid}), msgID(MESSAGE_DOMAIN_INVALID_SNAPPY, invalid); got != expected {
+		t.Fatalf("got invalid snappy msg id %s, expected %s", got, expected)
+	}
+}
@@ -0,0 +1,117 @@
+package eth2node
+
+import "sync"
+
+// How many slots of shard headers to remember, to match samples and blocks with
+const headerCacheSlots = 64
+
+// headerCacheLimit is the max number of headers to keep: one for each shard of the remembered slots,
+// and of the current slot, and the next slot (blocks and headers may be published ahead of the slot).
+func headerCacheLimit(shardCount uint64) int {
+	return int((headerCacheSlots + 2) * shardCount)
+}
+
+type proposalKey struct {
+	slot     Slot
+	shard    Shard
+	proposer ValidatorIndex
+}
+
+type headerAddResult uint8
+
+const (
+	headerAdded headerAddResult = iota
+	// exact same header was already known
+	headerDuplicate
+	// a different header was already known for the same slot, shard and proposer
+	headerEquivocation
+	// no more space, the cache is bounded, and the header is older than all the headers in the cache
+	headerCacheFull
+)
+
+// headerCache keeps the recent shard headers, indexed by header root (hash-tree-root of the unsigned header).
+// Only the first header of each (slot, shard, proposer) is kept.
+type headerCache struct {
+	sync.RWMutex
+	byRoot     map[Root]*SignedShardBlockHeader
+	byProposal map[proposalKey]Root
+	// max number of headers kept at any time
+	limit int
+}
+
+func newHeaderCache(limit int) *headerCache {
+	return &headerCache{
+		byRoot:     make(map[Root]*SignedShardBlockHeader),
+		byProposal: make(map[proposalKey]Root),
+		limit:      limit,
+	}
+}
+
+func (c *headerCache) add(root Root, header *SignedShardBlockHeader) headerAddResult {
+	c.Lock()
+	defer c.Unlock()
+	key := proposalKey{slot: header.Message.Slot, shard: header.Message.Shard, proposer: header.Message.ProposerIndex}
+	if prev, ok := c.byProposal[key]; ok {
+		if prev == root {
+			return headerDuplicate
+		}
+		return headerEquivocation
+	}
+	if len(c.byRoot) >= c.limit && !c.evictOldest(key.slot) {
+		return headerCacheFull
+	}
+	c.byRoot[root] = header
+	c.byProposal[key] = root
+	return headerAdded
+}
+
+// evictOldest removes the headers of the oldest slot, if that slot is older than the given slot.
+// Pruning normally keeps the cache within the limit, this makes room for new headers if pruning runs late.
+func (c *headerCache) evictOldest(slot Slot) bool {
+	oldest := slot
+	for key := range c.byProposal {
+		if key.slot < oldest {
+			oldest = key.slot
+		}
+	}
+	if oldest == slot {
+		return false
+	}
+	for key, root := range c.byProposal {
+		if key.slot == oldest {
+			delete(c.byProposal, key)
+			delete(c.byRoot, root)
+		}
+	}
+	return true
+}
+
+// get returns nil if the header is not known
+func (c *headerCache) get(root Root) *SignedShardBlockHeader {
+	c.RLock()
+	defer c.RUnlock()
+	return c.byRoot[root]
+}
+
+// getByProposal returns the first seen header of the proposal, or nil if none is known.
+func (c *headerCache) getByProposal(slot Slot, shard Shard, proposer ValidatorIndex) (Root, *SignedShardBlockHeader) {
+	c.RLock()
+	defer c.RUnlock()
+	root, ok := c.byProposal[proposalKey{slot: slot, shard: shard, proposer: proposer}]
+	if !ok {
+		return Root{}, nil
+	}
+	return root, c.byRoot[root]
+}
+
+// prune removes all headers older than the given slot
+func (c *headerCache) prune(minSlot Slot) {
+	c.Lock()
+	defer c.Unlock()
+	for key, root := range c.byProposal {
+		if key.slot < minSlot {
+			delete(c.byProposal, key)
+			delete(c.byRoot, root)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package eth2node
+
+import "testing"
+
+func TestHeaderCacheRetention(t *testing.T) {
+	shardCount := uint64(4)
+	c := newHeaderCache(headerCacheLimit(shardCount))
+	header := func(slot Slot, shard Shard) (Root, *SignedShardBlockHeader) {
+		h := &SignedShardBlockHeader{Message: ShardBlockHeader{Slot: slot, Shard: shard, ProposerIndex: ValidatorIndex(shard)}}
+		return Root{byte(slot), byte(slot >> 8), byte(shard), 1}, h
+	}
+	// run well past headerCacheSlots, with the headers of the next slot arriving early, and pruning like the node
+	for slot := Slot(0); slot < 3*headerCacheSlots; slot++ {
+		if slot > headerCacheSlots {
+			c.prune(slot - headerCacheSlots)
+		}
+		for _, s := range []Slot{slot, slot + 1} {
+			for shard := Shard(0); shard < Shard(shardCount); shard++ {
+				root, h := header(s, shard)
+				if res := c.add(root, h); res != headerAdded && res != headerDuplicate {
+					t.Fatalf("slot %d: failed to add header of slot %d shard %d: %d", slot, s, shard, res)
+				}
+			}
+		}
+		// the headers of all retained slots are still known
+		for s := Slot(0); s <= slot; s++ {
+			if slot > headerCacheSlots && s < slot-headerCacheSlots {
+				continue
+			}
+			if root, h := c.getByProposal(s, 0, 0); h == nil {
+				t.Fatalf("slot %d: missing header of slot %d", slot, s)
+			} else if expected, _ := header(s, 0); root != expected {
+				t.Fatalf("slot %d: unexpected header root of slot %d", slot, s)
+			}
+		}
+	}
+
+	// without pruning, the oldest slot is evicted to make space for newer headers
+	c = newHeaderCache(int(2 * shardCount))
+	for slot := Slot(10); slot < 13; slot++ {
+		for shard := Shard(0); shard < Shard(shardCount); shard++ {
+			root, h := header(slot, shard)
+			if res := c.add(root, h); res != headerAdded {
+				t.Fatalf("failed to add header of slot %d shard %d: %d", slot, shard, res)
+			}
+		}
+	}
+	if _, h := c.getByProposal(10, 0, 0); h != nil {
+		t.Fatal("expected oldest slot to be evicted")
+	}
+	if _, h := c.getByProposal(11, 0, 0); h == nil {
+		t.Fatal("expected slot 11 to be kept")
+	}
+	// headers older than everything in the full cache are not added
+	root, h := header(5, 0)
+	if res := c.add(root, h); res != headerCacheFull {
+		t.Fatalf("expected cache to be full for old header, got %d", res)
+	}
+}
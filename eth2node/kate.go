@@ -0,0 +1,452 @@
+package eth2node
+
+import (
+	"encoding/binary"
+	"fmt"
+	hbls "github.com/herumi/bls-eth-go-binary/bls"
+	verkle "github.com/protolambda/go-verkle"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+	"io"
+	"math/bits"
+	"os"
+)
+
+func init() {
+	if err := hbls.Init(hbls.BLS12_381); err != nil {
+		panic(fmt.Errorf("failed to initialize BLS library: %v", err))
+	}
+	if err := hbls.SetETHmode(hbls.EthModeDraft07); err != nil {
+		panic(fmt.Errorf("failed to set BLS library to eth mode: %v", err))
+	}
+}
+
+// Secret of the insecure test setup, used when no trusted setup file is configured.
+const insecureKateSecret = "eth2-das insecure kate setup"
+
+const (
+	kateG1Bytes = 48
+	kateG2Bytes = 96
+)
+
+// KateCommitment is a compressed G1 point, committing to the extended data of a shard block.
+type KateCommitment [kateG1Bytes]byte
+
+func (d *KateCommitment) Deserialize(dr *codec.DecodingReader) error {
+	_, err := dr.Read(d[:])
+	return err
+}
+
+func (d *KateCommitment) Serialize(w *codec.EncodingWriter) error {
+	return w.Write(d[:])
+}
+
+func (d *KateCommitment) ByteLength() uint64 {
+	return kateG1Bytes
+}
+
+func (d *KateCommitment) FixedLength() uint64 {
+	return kateG1Bytes
+}
+
+func (d *KateCommitment) HashTreeRoot(hFn tree.HashFn) Root {
+	return hFn.ByteVectorHTR(d[:])
+}
+
+// KateProof is a compressed G1 point, proving the points of a sample against a KateCommitment.
+type KateProof [kateG1Bytes]byte
+
+func (d *KateProof) Deserialize(dr *codec.DecodingReader) error {
+	_, err := dr.Read(d[:])
+	return err
+}
+
+func (d *KateProof) Serialize(w *codec.EncodingWriter) error {
+	return w.Write(d[:])
+}
+
+func (d *KateProof) ByteLength() uint64 {
+	return kateG1Bytes
+}
+
+func (d *KateProof) FixedLength() uint64 {
+	return kateG1Bytes
+}
+
+func (d *KateProof) HashTreeRoot(hFn tree.HashFn) Root {
+	return hFn.ByteVectorHTR(d[:])
+}
+
+// KateSetup is the trusted setup: the powers of some secret s, in G1 and G2.
+type KateSetup struct {
+	// [s^i]_1
+	G1 []hbls.G1
+	// [s^i]_2
+	G2 []hbls.G2
+}
+
+// InsecureKateSetup generates a deterministic setup from a known secret. For testing only.
+func InsecureKateSetup(secret string, g1Count uint64, g2Count uint64) *KateSetup {
+	var s hbls.Fr
+	s.SetHashOf([]byte(secret))
+
+	setup := &KateSetup{
+		G1: make([]hbls.G1, g1Count, g1Count),
+		G2: make([]hbls.G2, g2Count, g2Count),
+	}
+	var g1 hbls.G1
+	if err := g1.HashAndMapTo([]byte("eth2-das kate G1 generator")); err != nil {
+		panic(fmt.Errorf("failed to create G1 generator: %v", err))
+	}
+	for i := uint64(0); i < g1Count; i++ {
+		setup.G1[i] = g1
+		hbls.G1Mul(&g1, &g1, &s)
+	}
+	var g2 hbls.G2
+	if err := g2.HashAndMapTo([]byte("eth2-das kate G2 generator")); err != nil {
+		panic(fmt.Errorf("failed to create G2 generator: %v", err))
+	}
+	for i := uint64(0); i < g2Count; i++ {
+		setup.G2[i] = g2
+		hbls.G2Mul(&g2, &g2, &s)
+	}
+	return setup
+}
+
+// ReadKateSetup reads a setup: the G1 and G2 point counts as little-endian uint64 values,
+// followed by the compressed G1 points, and then the compressed G2 points.
+func ReadKateSetup(r io.Reader) (*KateSetup, error) {
+	var counts [16]byte
+	if _, err := io.ReadFull(r, counts[:]); err != nil {
+		return nil, fmt.Errorf("failed to read setup point counts: %v", err)
+	}
+	g1Count := binary.LittleEndian.Uint64(counts[:8])
+	g2Count := binary.LittleEndian.Uint64(counts[8:])
+	// sanity check, to not allocate crazy amounts of memory on a bad input
+	if g1Count > 1<<20 || g2Count > 1<<20 {
+		return nil, fmt.Errorf("setup is too large: %d G1 points, %d G2 points", g1Count, g2Count)
+	}
+	setup := &KateSetup{
+		G1: make([]hbls.G1, g1Count, g1Count),
+		G2: make([]hbls.G2, g2Count, g2Count),
+	}
+	var g1Buf [kateG1Bytes]byte
+	for i := uint64(0); i < g1Count; i++ {
+		if _, err := io.ReadFull(r, g1Buf[:]); err != nil {
+			return nil, fmt.Errorf("failed to read G1 point %d: %v", i, err)
+		}
+		if err := setup.G1[i].Deserialize(g1Buf[:]); err != nil {
+			return nil, fmt.Errorf("invalid G1 point %d: %v", i, err)
+		}
+	}
+	var g2Buf [kateG2Bytes]byte
+	for i := uint64(0); i < g2Count; i++ {
+		if _, err := io.ReadFull(r, g2Buf[:]); err != nil {
+			return nil, fmt.Errorf("failed to read G2 point %d: %v", i, err)
+		}
+		if err := setup.G2[i].Deserialize(g2Buf[:]); err != nil {
+			return nil, fmt.Errorf("invalid G2 point %d: %v", i, err)
+		}
+	}
+	return setup, nil
+}
+
+// LoadKateSetup reads the setup from the given file, see ReadKateSetup for the format.
+func LoadKateSetup(path string) (*KateSetup, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open setup file: %v", err)
+	}
+	defer f.Close()
+	return ReadKateSetup(f)
+}
+
+// Write the setup in the format read by ReadKateSetup
+func (s *KateSetup) Write(w io.Writer) error {
+	var counts [16]byte
+	binary.LittleEndian.PutUint64(counts[:8], uint64(len(s.G1)))
+	binary.LittleEndian.PutUint64(counts[8:], uint64(len(s.G2)))
+	if _, err := w.Write(counts[:]); err != nil {
+		return err
+	}
+	for i := range s.G1 {
+		if _, err := w.Write(s.G1[i].Serialize()); err != nil {
+			return err
+		}
+	}
+	for i := range s.G2 {
+		if _, err := w.Write(s.G2[i].Serialize()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// KateSettings commits to extended shard data, and creates and verifies proofs for each of its samples.
+// A sample is a range of POINTS_PER_SAMPLE points, proven with a single multi-point opening proof.
+type KateSettings struct {
+	setup *KateSetup
+
+	pointsPerSample uint64
+	// number of extended points, MAX_SAMPLES_PER_SHARD_BLOCK * POINTS_PER_SAMPLE
+	width uint64
+
+	fs *verkle.FFTSettings
+	// the roots of unity of the extended points, the points are the evaluations of the polynomial at these.
+	domain []hbls.Fr
+
+	// the polynomial that is zero on the points of each sample, in coefficient form
+	sampleZeroPolys [][]hbls.Fr
+	// and committed to in G2
+	sampleZeroCommits []hbls.G2
+}
+
+// NewKateSettings prepares the proving and verification work for the sample layout of the config.
+func (c *ExpandedConfig) NewKateSettings(setup *KateSetup) (*KateSettings, error) {
+	width := c.MAX_SAMPLES_PER_SHARD_BLOCK * c.POINTS_PER_SAMPLE
+	if width < 2 || width&(width-1) != 0 {
+		return nil, fmt.Errorf("extended points count must be a power of two, got %d", width)
+	}
+	if uint64(len(setup.G1)) < width {
+		return nil, fmt.Errorf("setup has %d G1 points, need at least %d", len(setup.G1), width)
+	}
+	if uint64(len(setup.G2)) < c.POINTS_PER_SAMPLE+1 {
+		return nil, fmt.Errorf("setup has %d G2 points, need at least %d", len(setup.G2), c.POINTS_PER_SAMPLE+1)
+	}
+	ks := &KateSettings{
+		setup:           setup,
+		pointsPerSample: c.POINTS_PER_SAMPLE,
+		width:           width,
+		fs:              verkle.NewFFTSettings(uint8(bits.Len64(width) - 1)),
+		domain:          make([]hbls.Fr, width, width),
+	}
+	for i := uint64(0); i < width; i++ {
+		if err := pointToFr(&ks.domain[i], &ks.fs.ExpandedRootsOfUnity[i]); err != nil {
+			return nil, fmt.Errorf("bad root of unity %d: %v", i, err)
+		}
+	}
+	ks.sampleZeroPolys = make([][]hbls.Fr, c.MAX_SAMPLES_PER_SHARD_BLOCK, c.MAX_SAMPLES_PER_SHARD_BLOCK)
+	ks.sampleZeroCommits = make([]hbls.G2, c.MAX_SAMPLES_PER_SHARD_BLOCK, c.MAX_SAMPLES_PER_SHARD_BLOCK)
+	for i := uint64(0); i < c.MAX_SAMPLES_PER_SHARD_BLOCK; i++ {
+		start := i * c.POINTS_PER_SAMPLE
+		zeroPoly := zeroPolyFor(ks.domain[start : start+c.POINTS_PER_SAMPLE])
+		ks.sampleZeroPolys[i] = zeroPoly
+		g2Lincomb(&ks.sampleZeroCommits[i], setup.G2[:len(zeroPoly)], zeroPoly)
+	}
+	return ks, nil
+}
+
+func pointToFr(dst *hbls.Fr, p *Point) error {
+	raw := verkle.BigNumTo32(p)
+	return dst.SetLittleEndian(raw[:])
+}
+
+// zeroPolyFor computes the coefficients of the polynomial that is zero at each of the given xs.
+func zeroPolyFor(xs []hbls.Fr) []hbls.Fr {
+	out := make([]hbls.Fr, len(xs)+1, len(xs)+1)
+	out[0].SetInt64(1)
+	var tmp hbls.Fr
+	for i := range xs {
+		// multiply by (x - xs[i])
+		for k := i + 1; k > 0; k-- {
+			hbls.FrMul(&tmp, &out[k], &xs[i])
+			hbls.FrSub(&out[k], &out[k-1], &tmp)
+		}
+		hbls.FrMul(&tmp, &out[0], &xs[i])
+		hbls.FrNeg(&out[0], &tmp)
+	}
+	return out
+}
+
+// polyFromPoints converts the extended points (evaluation form) to the polynomial coefficients.
+func (ks *KateSettings) polyFromPoints(extended []Point) ([]hbls.Fr, error) {
+	if uint64(len(extended)) != ks.width {
+		return nil, fmt.Errorf("expected %d extended points, got %d (shard data must be padded to the full width)", ks.width, len(extended))
+	}
+	coeffs, err := ks.fs.FFT(extended, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get polynomial coefficients: %v", err)
+	}
+	out := make([]hbls.Fr, len(coeffs), len(coeffs))
+	for i := range coeffs {
+		if err := pointToFr(&out[i], &coeffs[i]); err != nil {
+			return nil, fmt.Errorf("bad coefficient %d: %v", i, err)
+		}
+	}
+	return out, nil
+}
+
+func (ks *KateSettings) commitToPoly(coeffs []hbls.Fr) (out KateCommitment) {
+	var commit hbls.G1
+	g1Lincomb(&commit, ks.setup.G1[:len(coeffs)], coeffs)
+	copy(out[:], commit.Serialize())
+	return out
+}
+
+// g1Lincomb computes the linear combination of the points with the scalars
+func g1Lincomb(out *hbls.G1, points []hbls.G1, scalars []hbls.Fr) {
+	out.Clear()
+	var tmp hbls.G1
+	for i := range scalars {
+		hbls.G1Mul(&tmp, &points[i], &scalars[i])
+		hbls.G1Add(out, out, &tmp)
+	}
+}
+
+// g2Lincomb computes the linear combination of the points with the scalars
+func g2Lincomb(out *hbls.G2, points []hbls.G2, scalars []hbls.Fr) {
+	out.Clear()
+	var tmp hbls.G2
+	for i := range scalars {
+		hbls.G2Mul(&tmp, &points[i], &scalars[i])
+		hbls.G2Add(out, out, &tmp)
+	}
+}
+
+// Commit to the extended points. These are always MAX_SAMPLES_PER_SHARD_BLOCK * POINTS_PER_SAMPLE points:
+// shardDataToPoints pads shard data of any size to the full width.
+func (ks *KateSettings) Commit(extended []Point) (KateCommitment, error) {
+	coeffs, err := ks.polyFromPoints(extended)
+	if err != nil {
+		return KateCommitment{}, err
+	}
+	return ks.commitToPoly(coeffs), nil
+}
+
+// ProveSamples commits to the extended points, and creates a proof for each of the samples,
+// in the same order as the samples of MakeSamples. Like Commit, the points must be of the full width.
+func (ks *KateSettings) ProveSamples(extended []Point) (KateCommitment, []KateProof, error) {
+	coeffs, err := ks.polyFromPoints(extended)
+	if err != nil {
+		return KateCommitment{}, nil, err
+	}
+	commitment := ks.commitToPoly(coeffs)
+	proofs := make([]KateProof, len(ks.sampleZeroPolys), len(ks.sampleZeroPolys))
+	for i := range ks.sampleZeroPolys {
+		proofs[i] = ks.proveSample(coeffs, i)
+	}
+	return commitment, proofs, nil
+}
+
+// ProveSampleIndices creates a proof for each of the given samples of the extended points, in the order of the indices.
+// Cheaper than ProveSamples if only a few of the samples are needed.
+func (ks *KateSettings) ProveSampleIndices(extended []Point, indices []SampleIndex) ([]KateProof, error) {
+	coeffs, err := ks.polyFromPoints(extended)
+	if err != nil {
+		return nil, err
+	}
+	proofs := make([]KateProof, len(indices), len(indices))
+	for i, sampleIndex := range indices {
+		if uint64(sampleIndex) >= uint64(len(ks.sampleZeroPolys)) {
+			return nil, fmt.Errorf("sample index %d out of range", sampleIndex)
+		}
+		proofs[i] = ks.proveSample(coeffs, int(sampleIndex))
+	}
+	return proofs, nil
+}
+
+// proveSample creates the proof of the sample at the given index, for the polynomial coefficients.
+func (ks *KateSettings) proveSample(coeffs []hbls.Fr, i int) (out KateProof) {
+	// the quotient q(x) = (p(x) - I(x)) / Z(x), where I(x) is the remainder of p(x) / Z(x)
+	quotient := polyQuotient(coeffs, ks.sampleZeroPolys[i])
+	var proof hbls.G1
+	g1Lincomb(&proof, ks.setup.G1[:len(quotient)], quotient)
+	copy(out[:], proof.Serialize())
+	return out
+}
+
+// polyQuotient divides the dividend by the (monic) divisor with long division, and returns the quotient.
+func polyQuotient(dividend []hbls.Fr, divisor []hbls.Fr) []hbls.Fr {
+	n := len(divisor) - 1
+	if len(dividend) <= n {
+		return []hbls.Fr{{}}
+	}
+	rem := make([]hbls.Fr, len(dividend), len(dividend))
+	copy(rem, dividend)
+	out := make([]hbls.Fr, len(dividend)-n, len(dividend)-n)
+	var tmp hbls.Fr
+	for i := len(dividend) - 1; i >= n; i-- {
+		q := &out[i-n]
+		*q = rem[i]
+		for j := 0; j <= n; j++ {
+			hbls.FrMul(&tmp, q, &divisor[j])
+			hbls.FrSub(&rem[i-n+j], &rem[i-n+j], &tmp)
+		}
+	}
+	return out
+}
+
+// VerifySample checks the proof of the sample at the given index, against the commitment in the header.
+func (ks *KateSettings) VerifySample(header *ShardBlockHeader, sampleIndex SampleIndex, sample ShardBlockDataChunk, proof KateProof) error {
+	if uint64(sampleIndex) >= uint64(len(ks.sampleZeroPolys)) {
+		return fmt.Errorf("sample index %d out of range", sampleIndex)
+	}
+	if uint64(len(sample)) != ks.pointsPerSample*BYTES_PER_FULL_POINT {
+		return fmt.Errorf("sample has bad length %d", len(sample))
+	}
+	var commitment hbls.G1
+	if err := commitment.Deserialize(header.BodyCommitment[:]); err != nil {
+		return fmt.Errorf("bad commitment: %v", err)
+	}
+	var proofPoint hbls.G1
+	if err := proofPoint.Deserialize(proof[:]); err != nil {
+		return fmt.Errorf("bad proof: %v", err)
+	}
+	ys := make([]hbls.Fr, ks.pointsPerSample, ks.pointsPerSample)
+	for i := uint64(0); i < ks.pointsPerSample; i++ {
+		if err := ys[i].SetLittleEndian(sample[i*BYTES_PER_FULL_POINT : (i+1)*BYTES_PER_FULL_POINT]); err != nil {
+			return fmt.Errorf("bad point %d: %v", i, err)
+		}
+	}
+	start := uint64(sampleIndex) * ks.pointsPerSample
+	xs := ks.domain[start : start+ks.pointsPerSample]
+	interpolation := interpolatePoly(xs, ys, ks.sampleZeroPolys[sampleIndex])
+
+	// e(C - [I(s)]_1, [1]_2) == e(proof, [Z(s)]_2)
+	var interpolationCommit hbls.G1
+	g1Lincomb(&interpolationCommit, ks.setup.G1[:len(interpolation)], interpolation)
+	var commitMinusInterpolation hbls.G1
+	hbls.G1Sub(&commitMinusInterpolation, &commitment, &interpolationCommit)
+	var lhs, rhs hbls.GT
+	hbls.Pairing(&lhs, &commitMinusInterpolation, &ks.setup.G2[0])
+	hbls.Pairing(&rhs, &proofPoint, &ks.sampleZeroCommits[sampleIndex])
+	if !lhs.IsEqual(&rhs) {
+		return fmt.Errorf("proof of sample %d does not match commitment", sampleIndex)
+	}
+	return nil
+}
+
+// interpolatePoly computes the coefficients of the lowest degree polynomial through the (x, y) points,
+// with Lagrange interpolation. zeroPoly is the polynomial that is zero at each of the xs.
+func interpolatePoly(xs []hbls.Fr, ys []hbls.Fr, zeroPoly []hbls.Fr) []hbls.Fr {
+	n := len(xs)
+	out := make([]hbls.Fr, n, n)
+	var tmp, denom, scale hbls.Fr
+	for i := 0; i < n; i++ {
+		// Z(x) / (x - xs[i])
+		basis := polyQuotient(zeroPoly, linearPoly(&xs[i]))
+		// product of (xs[i] - xs[j]) for j != i
+		denom.SetInt64(1)
+		for j := 0; j < n; j++ {
+			if j == i {
+				continue
+			}
+			hbls.FrSub(&tmp, &xs[i], &xs[j])
+			hbls.FrMul(&denom, &denom, &tmp)
+		}
+		hbls.FrDiv(&scale, &ys[i], &denom)
+		for k := 0; k < n; k++ {
+			hbls.FrMul(&tmp, &basis[k], &scale)
+			hbls.FrAdd(&out[k], &out[k], &tmp)
+		}
+	}
+	return out
+}
+
+// linearPoly returns the coefficients of (x - root)
+func linearPoly(root *hbls.Fr) []hbls.Fr {
+	out := make([]hbls.Fr, 2, 2)
+	hbls.FrNeg(&out[0], root)
+	out[1].SetInt64(1)
+	return out
+}
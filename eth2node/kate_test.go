@@ -0,0 +1,76 @@
+package eth2node
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestKateSampleProofs(t *testing.T) {
+	conf := testPointsConfig()
+	setup, err := conf.KateSetup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := conf.NewKateSettings(setup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(789))
+	// small bodies are padded to the full width, and are proven like full bodies
+	for _, size := range []uint64{0, 100, conf.MAX_DATA_SIZE / 2, conf.MAX_DATA_SIZE} {
+		data := make([]byte, size, size)
+		rng.Read(data)
+		points, err := conf.shardDataToPoints(data)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		commitment, proofs, err := ks.ProveSamples(points)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if c, err := ks.Commit(points); err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		} else if c != commitment {
+			t.Fatalf("size %d: commitment of Commit and ProveSamples do not match", size)
+		}
+		samples, err := conf.pointsToSamples(points)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if len(proofs) != len(samples) || uint64(len(samples)) != conf.MAX_SAMPLES_PER_SHARD_BLOCK {
+			t.Fatalf("size %d: expected %d proofs and samples, got %d and %d", size, conf.MAX_SAMPLES_PER_SHARD_BLOCK, len(proofs), len(samples))
+		}
+		// proving only some of the samples gives the same proofs
+		selected, err := ks.ProveSampleIndices(points, []SampleIndex{3, 0})
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if selected[0] != proofs[3] || selected[1] != proofs[0] {
+			t.Fatalf("size %d: proofs of selected samples do not match", size)
+		}
+		header := &ShardBlockHeader{BodyCommitment: commitment}
+		for i, sample := range samples {
+			if err := ks.VerifySample(header, SampleIndex(i), sample, proofs[i]); err != nil {
+				t.Fatalf("size %d: sample %d failed to verify: %v", size, i, err)
+			}
+		}
+
+		// proof for a different sample.
+		// Without data, every sample is zero and every proof is the identity, so the proofs are interchangeable.
+		if size > 0 {
+			if err := ks.VerifySample(header, 0, samples[0], proofs[1]); err == nil {
+				t.Fatalf("size %d: expected proof of other sample to fail", size)
+			}
+		}
+		// modified sample data
+		forged := append(ShardBlockDataChunk{}, samples[2]...)
+		forged[0] ^= 1
+		if err := ks.VerifySample(header, 2, forged, proofs[2]); err == nil {
+			t.Fatalf("size %d: expected forged sample to fail", size)
+		}
+	}
+	// points that are not of the full width are not accepted
+	if _, err := ks.Commit(make([]Point, 2, 2)); err == nil {
+		t.Fatal("expected error when committing to points that are not of the full width")
+	}
+}
@@ -0,0 +1,67 @@
+package eth2node
+
+import (
+	"github.com/libp2p/go-libp2p-core/peer"
+	pubsub_pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"sync"
+)
+
+// meshTracker is a gossipsub event tracer that keeps track of the mesh peers of each topic,
+// since gossipsub does not expose the mesh itself.
+type meshTracker struct {
+	sync.Mutex
+	// topic -> mesh peers
+	mesh map[string]map[peer.ID]struct{}
+}
+
+func newMeshTracker() *meshTracker {
+	return &meshTracker{mesh: make(map[string]map[peer.ID]struct{})}
+}
+
+// Trace is called by gossipsub for every event, only the mesh changes are tracked.
+func (m *meshTracker) Trace(evt *pubsub_pb.TraceEvent) {
+	switch evt.GetType() {
+	case pubsub_pb.TraceEvent_GRAFT:
+		topic := evt.GetGraft().GetTopic()
+		m.Lock()
+		peers, ok := m.mesh[topic]
+		if !ok {
+			peers = make(map[peer.ID]struct{})
+			m.mesh[topic] = peers
+		}
+		peers[peer.ID(evt.GetGraft().GetPeerID())] = struct{}{}
+		m.Unlock()
+	case pubsub_pb.TraceEvent_PRUNE:
+		topic := evt.GetPrune().GetTopic()
+		m.Lock()
+		if peers, ok := m.mesh[topic]; ok {
+			delete(peers, peer.ID(evt.GetPrune().GetPeerID()))
+			if len(peers) == 0 {
+				delete(m.mesh, topic)
+			}
+		}
+		m.Unlock()
+	case pubsub_pb.TraceEvent_REMOVE_PEER:
+		// disconnected peers are removed from the mesh of every topic, without a prune event
+		id := peer.ID(evt.GetRemovePeer().GetPeerID())
+		m.Lock()
+		for topic, peers := range m.mesh {
+			delete(peers, id)
+			if len(peers) == 0 {
+				delete(m.mesh, topic)
+			}
+		}
+		m.Unlock()
+	case pubsub_pb.TraceEvent_LEAVE:
+		m.Lock()
+		delete(m.mesh, evt.GetLeave().GetTopic())
+		m.Unlock()
+	}
+}
+
+// size returns the number of mesh peers of the topic
+func (m *meshTracker) size(topic string) uint64 {
+	m.Lock()
+	defer m.Unlock()
+	return uint64(len(m.mesh[topic]))
+}
@@ -0,0 +1,41 @@
+package eth2node
+
+import (
+	pubsub_pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"testing"
+)
+
+func TestMeshTracker(t *testing.T) {
+	m := newMeshTracker()
+	graft := func(id string, topic string) {
+		m.Trace(&pubsub_pb.TraceEvent{Type: pubsub_pb.TraceEvent_GRAFT.Enum(), Graft: &pubsub_pb.TraceEvent_Graft{PeerID: []byte(id), Topic: &topic}})
+	}
+	prune := func(id string, topic string) {
+		m.Trace(&pubsub_pb.TraceEvent{Type: pubsub_pb.TraceEvent_PRUNE.Enum(), Prune: &pubsub_pb.TraceEvent_Prune{PeerID: []byte(id), Topic: &topic}})
+	}
+	expect := func(topic string, size uint64) {
+		t.Helper()
+		if got := m.size(topic); got != size {
+			t.Fatalf("expected %d mesh peers on %s, got %d", size, topic, got)
+		}
+	}
+	graft("a", "x")
+	graft("b", "x")
+	graft("a", "x") // duplicate
+	graft("a", "y")
+	expect("x", 2)
+	expect("y", 1)
+	prune("b", "x")
+	expect("x", 1)
+	// disconnected peers leave every mesh
+	m.Trace(&pubsub_pb.TraceEvent{Type: pubsub_pb.TraceEvent_REMOVE_PEER.Enum(), RemovePeer: &pubsub_pb.TraceEvent_RemovePeer{PeerID: []byte("a")}})
+	expect("x", 0)
+	expect("y", 0)
+	// leaving a topic clears its mesh
+	graft("c", "z")
+	topic := "z"
+	m.Trace(&pubsub_pb.TraceEvent{Type: pubsub_pb.TraceEvent_LEAVE.Enum(), Leave: &pubsub_pb.TraceEvent_Leave{Topic: &topic}})
+	expect("z", 0)
+	// other events are ignored
+	m.Trace(&pubsub_pb.TraceEvent{Type: pubsub_pb.TraceEvent_DELIVER_MESSAGE.Enum()})
+}
@@ -0,0 +1,23 @@
+package eth2node
+
+import pubsub "github.com/libp2p/go-libp2p-pubsub"
+
+// MessageSink observes every message received on the topics the node is subscribed to.
+// Messages published by the node itself are not passed to the sink.
+// The message data is snappy compressed, as it is published on the ssz_snappy topics.
+// OnMessage is called from the topic handler goroutines, and may be called concurrently.
+type MessageSink interface {
+	OnMessage(topic string, msg *pubsub.Message)
+}
+
+type noopMessageSink struct{}
+
+func (noopMessageSink) OnMessage(topic string, msg *pubsub.Message) {}
+
+// SetMessageSink changes the sink that received messages are passed to. Must be called before Start.
+func (n *Eth2Node) SetMessageSink(sink MessageSink) {
+	if sink == nil {
+		sink = noopMessageSink{}
+	}
+	n.sink = sink
+}
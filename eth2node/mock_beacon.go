@@ -0,0 +1,48 @@
+package eth2node
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// BeaconView provides the beacon chain data that the shard network depends on:
+// the randomness for committees and proposers, the beacon block roots, and the active validators.
+type BeaconView interface {
+	// Seed returns the randomness to shuffle the shard committees and select the shard proposers of the epoch with.
+	Seed(epoch Epoch) (Root, error)
+	// BlockRoot returns the root of the latest beacon block at or before the slot.
+	BlockRoot(slot Slot) (Root, error)
+	// ActiveValidators returns the indices of the validators that are active in the epoch, in increasing order.
+	ActiveValidators(epoch Epoch) ([]ValidatorIndex, error)
+}
+
+// MockBeaconView is a deterministic beacon chain, without any state:
+// every slot has a beacon block, the seed and roots are hashes of the epoch and slot,
+// and all validators are active.
+type MockBeaconView struct {
+	ValidatorCount uint64
+}
+
+func mockBeaconHash(kind string, v uint64) (out Root) {
+	h := sha256.New()
+	h.Write([]byte(kind))
+	binary.Write(h, binary.LittleEndian, v)
+	copy(out[:], h.Sum(nil))
+	return
+}
+
+func (m *MockBeaconView) Seed(epoch Epoch) (Root, error) {
+	return mockBeaconHash("seed", uint64(epoch)), nil
+}
+
+func (m *MockBeaconView) BlockRoot(slot Slot) (Root, error) {
+	return mockBeaconHash("block", uint64(slot)), nil
+}
+
+func (m *MockBeaconView) ActiveValidators(epoch Epoch) ([]ValidatorIndex, error) {
+	out := make([]ValidatorIndex, m.ValidatorCount, m.ValidatorCount)
+	for i := range out {
+		out[i] = ValidatorIndex(i)
+	}
+	return out, nil
+}
@@ -8,21 +8,67 @@ import (
 // peer ID -> list of multi Addresses (excl. /p2p/ component)
 type MockDiscovery struct {
 	Peers map[peer.ID][]ma.Multiaddr
+	// peer ID -> validators run by the peer. Optional, to find the peers of shard committees.
+	Validators map[peer.ID][]ValidatorIndex
+	// peer ID -> SLOW_INDICES count of the peer. Optional, peers without an entry have the same SLOW_INDICES as us.
+	SlowIndexCounts map[peer.ID]uint64
+
+	index BackboneIndex
 }
 
-func (m *MockDiscovery) FindPublic(conf *ExpandedConfig, slot Slot, subnets map[VerticalIndex]struct{}) map[VerticalIndex][]peer.ID {
-	candidates := make(map[VerticalIndex][]peer.ID, len(subnets))
+// syncIndex adds and removes peers in the backbone index, to match the Peers and SlowIndexCounts of the mock.
+func (m *MockDiscovery) syncIndex(conf *ExpandedConfig) {
+	m.index.Lock()
+	var removed []peer.ID
+	for id := range m.index.peers {
+		if _, ok := m.Peers[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	m.index.Unlock()
+	for _, id := range removed {
+		m.index.RemovePeer(id)
+	}
 	for id := range m.Peers {
-		// TODO: does everyone have the same SLOW_INDICES parameter, or may it vary per node?
 		// TODO: also, in a real Eth2 scenario, the ENR needs to at least say "yes/no DAS subnet user"
-		remoteSubs := conf.DasSlowSubnetIndices(id, slot, conf.SLOW_INDICES)
-		for s := range remoteSubs {
-			if _, ok := subnets[s]; ok {
-				candidates[s] = append(candidates[s], id)
+		slowIndices, ok := m.SlowIndices(id)
+		if !ok {
+			slowIndices = conf.SLOW_INDICES
+		}
+		m.index.AddPeer(id, slowIndices)
+	}
+}
+
+func (m *MockDiscovery) FindPublic(conf *ExpandedConfig, slot Slot, subnets map[VerticalIndex]struct{}) map[VerticalIndex][]peer.ID {
+	m.syncIndex(conf)
+	return m.index.Find(conf, slot, subnets)
+}
+
+func (m *MockDiscovery) PrefetchPublic(conf *ExpandedConfig, slot Slot) {
+	m.syncIndex(conf)
+	m.index.Prefetch(conf, slot)
+}
+
+func (m *MockDiscovery) SlowIndices(id peer.ID) (count uint64, ok bool) {
+	count, ok = m.SlowIndexCounts[id]
+	return
+}
+
+func (m *MockDiscovery) FindCommitteePeers(committee []ValidatorIndex) []peer.ID {
+	members := make(map[ValidatorIndex]struct{}, len(committee))
+	for _, val := range committee {
+		members[val] = struct{}{}
+	}
+	var out []peer.ID
+	for id, vals := range m.Validators {
+		for _, val := range vals {
+			if _, ok := members[val]; ok {
+				out = append(out, id)
+				break
 			}
 		}
 	}
-	return candidates
+	return out
 }
 
 // Get addrs of a peer, may be nil if the peer is unknown.
@@ -31,6 +77,15 @@ func (m *MockDiscovery) Addrs(id peer.ID) []ma.Multiaddr {
 }
 
 type Discovery interface {
+	// FindPublic returns the peers that are publicly subscribed to any of the given subnets at the slot,
+	// based on the SLOW_INDICES count that each peer advertises.
 	FindPublic(conf *ExpandedConfig, slot Slot, subnets map[VerticalIndex]struct{}) map[VerticalIndex][]peer.ID
+	// PrefetchPublic prepares the backbone of a future slot, to make a later FindPublic of the slot fast.
+	PrefetchPublic(conf *ExpandedConfig, slot Slot)
+	// SlowIndices returns the SLOW_INDICES count advertised by the peer, ok is false if the peer is unknown.
+	// Super-nodes advertise a large count: they are the high-capacity part of the backbone.
+	SlowIndices(id peer.ID) (count uint64, ok bool)
+	// FindCommitteePeers returns the peers that run any of the validators of the committee.
+	FindCommitteePeers(committee []ValidatorIndex) []peer.ID
 	Addrs(id peer.ID) []ma.Multiaddr
 }
@@ -2,17 +2,15 @@ package eth2node
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/base64"
 	"fmt"
 	"github.com/libp2p/go-libp2p"
 	connmgr "github.com/libp2p/go-libp2p-connmgr"
+	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/peer"
 	mplex "github.com/libp2p/go-libp2p-mplex"
 	noise "github.com/libp2p/go-libp2p-noise"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
-	pubsub_pb "github.com/libp2p/go-libp2p-pubsub/pb"
 	basichost "github.com/libp2p/go-libp2p/p2p/host/basic"
 	"github.com/libp2p/go-tcp-transport"
 	ma "github.com/multiformats/go-multiaddr"
@@ -52,6 +50,12 @@ type Eth2Node struct {
 	disc Discovery
 	conf ExpandedConfig
 
+	// Provides the beacon chain randomness, roots and validators
+	beaconView BeaconView
+
+	// To commit to shard data, and prove and verify samples
+	kate *KateSettings
+
 	// to kill main loop
 	kill chan struct{}
 
@@ -79,14 +83,54 @@ type Eth2Node struct {
 	// currently randomly joined verticalSubnets, quickly rotates
 	fastIndices map[VerticalIndex]*subnetFastInfo
 
-	// current shard committees. Shaped as shard -> committee
-	// TODO: currently these don't change, as in real-world these would be changing super slow (days)
-	// So keep things simple.
-	shard2Vals [][]ValidatorIndex
-	val2Shard  []Shard
+	// Recent shard headers, to match samples and blocks with
+	headers *headerCache
+	// Shard blocks that arrived before their header
+	pendingBlocks *pendingBlocks
+
+	// First valid sample for each (header root, index)
+	seenSamples seenSamples
+	// Message IDs of the samples this node published
+	publishedSamples msgIDCache
+
+	// Snapshot of the SLOW_INDICES and FAST_INDICES subnets, and the slot they were subscribed at.
+	// Updated after each rotation, for use outside of the main loop.
+	ownIndices     map[VerticalIndex]Slot
+	ownIndicesLock sync.RWMutex
+
+	// How well peered new SLOW_INDICES subnets were at the switch
+	slowSwitchStats     SlowSwitchStats
+	slowSwitchStatsLock sync.Mutex
+	// The gossipsub mesh peers of each topic
+	mesh *meshTracker
+	// Backbone peers of upcoming SLOW_INDICES subnets, protected from connection manager trimming until the switch slot.
+	// Only used by the main loop.
+	lookaheadProtected map[peer.ID]Slot
+
+	vertValidationStats   *ValidationStats
+	horzValidationStats   *ValidationStats
+	headerValidationStats *ValidationStats
+
+	// Which samples of recent shard blocks were received, and the availability verdicts
+	availability *availabilityTracker
+
+	// Recovers and republishes missing samples, if enabled for any shards
+	repair *repairer
+
+	// Buffer of recently seen samples, to serve to peers
+	samples SampleStore
+
+	// Observes all received messages, for tests and metrics
+	sink MessageSink
+
+	// shard committees, by committee period
+	committees committeeCache
+
+	// block tree and fork choice of each shard
+	shardChains *shardChains
 }
 
-func New(ctx context.Context, conf *Config, disc Discovery, log *zap.SugaredLogger) (*Eth2Node, error) {
+func New(ctx context.Context, conf *Config, disc Discovery, beaconView BeaconView, log *zap.SugaredLogger) (*Eth2Node, error) {
 	options := []libp2p.Option{
 		libp2p.Transport(tcp.NewTCPTransport),
 		libp2p.Muxer("/mplex/6.7.0", mplex.DefaultTransport),
@@ -96,6 +140,10 @@ func New(ctx context.Context, conf *Config, disc Discovery, log *zap.SugaredLogg
 		libp2p.Ping(false),
 		libp2p.DisableRelay(),
 	}
+	// discovery that relies on the node identity, e.g. the ENR key of discv5, provides the identity
+	if idDisc, ok := disc.(interface{ Identity() crypto.PrivKey }); ok {
+		options = append(options, libp2p.Identity(idDisc.Identity()))
+	}
 	if conf.ENABLE_NAT {
 		options = append(options, libp2p.NATManager(basichost.NewNATManager))
 	}
@@ -107,7 +155,9 @@ func New(ctx context.Context, conf *Config, disc Discovery, log *zap.SugaredLogg
 	if err != nil {
 		return nil, errors.Wrap(err, "failed host init")
 	}
+	mesh := newMeshTracker()
 	psOptions := []pubsub.Option{
+		pubsub.WithEventTracer(mesh),
 		pubsub.WithNoAuthor(),
 		pubsub.WithMessageSignaturePolicy(pubsub.StrictNoSign),
 		pubsub.WithMessageIdFn(MsgIDFunction),
@@ -122,9 +172,22 @@ func New(ctx context.Context, conf *Config, disc Discovery, log *zap.SugaredLogg
 		return nil, errors.Wrap(err, "failed gossipsub init")
 	}
 
+	expandedConf := conf.Expand()
+	setup, err := expandedConf.KateSetup()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load kate setup")
+	}
+	kate, err := expandedConf.NewKateSettings(setup)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed kate settings init")
+	}
+	samples, err := expandedConf.NewSampleStore()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed sample store init")
+	}
+
 	subCtx, subCancel := context.WithCancel(context.Background())
 
-	expandedConf := conf.Expand()
 	n := &Eth2Node{
 		subProcesses: struct {
 			ctx    context.Context
@@ -133,7 +196,9 @@ func New(ctx context.Context, conf *Config, disc Discovery, log *zap.SugaredLogg
 		h:               h,
 		ps:              ps,
 		disc:            disc,
+		beaconView:      beaconView,
 		conf:            expandedConf,
+		kate:            kate,
 		dialReq:         make(chan peer.ID, 30), // don't try to schedule too many dials at a time.
 		localValidators: make(map[ValidatorIndex]struct{}),
 		horizontalSubs:  make(map[Shard]*pubsub.Subscription),
@@ -141,9 +206,35 @@ func New(ctx context.Context, conf *Config, disc Discovery, log *zap.SugaredLogg
 		fastIndices:     make(map[VerticalIndex]*subnetFastInfo),
 		log:             log,
 		kill:            make(chan struct{}),
+		headers:         newHeaderCache(headerCacheLimit(conf.SHARD_COUNT)),
+		pendingBlocks:   newPendingBlocks(pendingBlocksLimit(conf.SHARD_COUNT)),
+		seenSamples:     seenSamples{seen: make(map[sampleSeenKey]Slot)},
+		ownIndices:      make(map[VerticalIndex]Slot),
+
+		publishedSamples: msgIDCache{ids: make(map[string]Slot)},
+
+		vertValidationStats:   newValidationStats(),
+		horzValidationStats:   newValidationStats(),
+		headerValidationStats: newValidationStats(),
+
+		slowSwitchStats: SlowSwitchStats{MeshPeers: make(map[uint64]uint64)},
+		mesh:            mesh,
+
+		lookaheadProtected: make(map[peer.ID]Slot),
+
+		committees:   committeeCache{periods: make(map[uint64]*shardCommittees)},
+		shardChains:  newShardChains(conf.SHARD_COUNT),
+		availability: newAvailabilityTracker(),
+		samples:      samples,
+		repair:       newRepairer(),
+		sink:         noopMessageSink{},
+	}
+
+	if _, err := n.shardCommitteesAt(0); err != nil {
+		return nil, errors.Wrap(err, "failed to compute shard committees")
 	}
 
-	n.shard2Vals, n.val2Shard = n.shardCommitteeShuffling(0)
+	h.SetStreamHandler(SamplesByIndexProtocol, n.handleSamplesByIndex)
 
 	if err := n.joinInitialTopics(); err != nil {
 		return nil, err
@@ -155,6 +246,21 @@ func (n *Eth2Node) Stats() (peerCount uint64) {
 	return uint64(len(n.h.Network().Peers()))
 }
 
+// VertValidationStats counts the vertical subnet validation results, by reason.
+func (n *Eth2Node) VertValidationStats() map[string]uint64 {
+	return n.vertValidationStats.Snapshot()
+}
+
+// HorzValidationStats counts the horizontal subnet validation results, by reason.
+func (n *Eth2Node) HorzValidationStats() map[string]uint64 {
+	return n.horzValidationStats.Snapshot()
+}
+
+// HeaderValidationStats counts the shard header validation results, by reason.
+func (n *Eth2Node) HeaderValidationStats() map[string]uint64 {
+	return n.headerValidationStats.Snapshot()
+}
+
 func (n *Eth2Node) DiscInfo() (peer.ID, []ma.Multiaddr) {
 	return n.h.ID(), n.h.Addrs()
 }
@@ -210,6 +316,12 @@ func (n *Eth2Node) processLoop() {
 	// TODO schedule work publishing etc.
 	workTicker := n.conf.TickerWithOffset(slotDuration, slotDuration/3*2)
 
+	pullTicker := n.conf.TickerWithOffset(slotDuration, n.conf.PULL_DEADLINE)
+	defer pullTicker.Stop()
+
+	availabilityTicker := n.conf.TickerWithOffset(slotDuration, n.conf.AVAILABILITY_DEADLINE)
+	defer availabilityTicker.Stop()
+
 	for {
 		select {
 		case _, _ = <-n.kill:
@@ -233,7 +345,32 @@ func (n *Eth2Node) processLoop() {
 
 			n.rotateSlowVertSubnets(slot)
 			n.rotateFastVertSubnets(slot)
+			n.updateOwnIndices()
+			n.updateRepairSubnets(slot)
+			n.updateHorzSubnets(slot)
 			n.peersUpdate(slot)
+			n.slowPeersLookahead(slot)
+			if period := n.conf.CommitteePeriod(slot); period > 0 {
+				n.committees.prune(period - 1)
+			}
+			if slot > 0 {
+				n.pendingBlocks.prune(slot - 1)
+			}
+			if slot > headerCacheSlots {
+				n.headers.prune(slot - headerCacheSlots)
+				n.shardChains.prune(slot - headerCacheSlots)
+				n.availability.prune(slot - headerCacheSlots)
+			}
+			if slot > SAMPLE_PROPAGATION_SLOT_RANGE {
+				n.seenSamples.prune(slot - SAMPLE_PROPAGATION_SLOT_RANGE)
+				n.publishedSamples.prune(slot - SAMPLE_PROPAGATION_SLOT_RANGE)
+				n.repair.prune(slot - SAMPLE_PROPAGATION_SLOT_RANGE)
+			}
+			if slot > Slot(n.conf.SAMPLE_STORE_RETENTION_SLOTS) {
+				if err := n.samples.Prune(slot - Slot(n.conf.SAMPLE_STORE_RETENTION_SLOTS)); err != nil {
+					n.log.With(zap.Error(err)).Warn("failed to prune sample store")
+				}
+			}
 		case t := <-workTicker.C:
 			// 1/3 before every slot, prepare and schedule shard blocks
 			slot, preGenesis := n.conf.SlotWithOffset(t, slotDuration/3)
@@ -241,6 +378,20 @@ func (n *Eth2Node) processLoop() {
 				continue
 			}
 			n.scheduleShardProposalsMaybe(slot)
+			// prepare the backbone of the next slot, for peering and pulling
+			n.disc.PrefetchPublic(&n.conf, slot)
+		case t := <-pullTicker.C:
+			slot, preGenesis := n.conf.SlotWithOffset(t, -n.conf.PULL_DEADLINE)
+			if preGenesis {
+				continue
+			}
+			go n.pullMissingSamples(slot)
+		case t := <-availabilityTicker.C:
+			slot, preGenesis := n.conf.SlotWithOffset(t, -n.conf.AVAILABILITY_DEADLINE)
+			if preGenesis {
+				continue
+			}
+			n.decideAvailability(slot)
 		case id := <-n.dialReq:
 			addrs := n.disc.Addrs(id)
 			addrInfo := peer.AddrInfo{Addrs: addrs, ID: id}
@@ -263,6 +414,9 @@ func (n *Eth2Node) Close() error {
 	n.kill <- struct{}{}
 	close(n.kill)
 	n.subProcesses.cancel()
+	if err := n.samples.Close(); err != nil {
+		n.log.With(zap.Error(err)).Warn("failed to close sample store")
+	}
 	return n.h.Close()
 }
 
@@ -282,7 +436,8 @@ func (n *Eth2Node) initialSubscriptions() error {
 	}
 	n.rotateSlowVertSubnets(slot)
 	n.rotateFastVertSubnets(slot)
-	n.subscribeHorzSubnets()
+	n.updateOwnIndices()
+	n.updateHorzSubnets(slot)
 	return nil
 }
 
@@ -371,11 +526,3 @@ func (n *Eth2Node) handleTopicEvents(name string, t *pubsub.Topic) {
 		}
 	}
 }
-
-func MsgIDFunction(pmsg *pubsub_pb.Message) string {
-	h := sha256.New()
-	// never errors, see crypto/sha256 Go doc
-	_, _ = h.Write(pmsg.Data) // TODO:  do we want snappy compressed messages?
-	id := h.Sum(nil)[:20]
-	return base64.URLEncoding.EncodeToString(id)
-}
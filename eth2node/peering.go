@@ -2,8 +2,34 @@ package eth2node
 
 import (
 	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"math/rand"
+	"sort"
 )
 
+// preferSuperNodes orders the backbone peers by their advertised SLOW_INDICES count, largest first,
+// so that super-nodes are dialed first: they cover the most subnets, also after future rotations.
+// Peers with the same count are shuffled, to not all prefer the same few peers.
+func (n *Eth2Node) preferSuperNodes(peers []peer.ID) []peer.ID {
+	out := make([]peer.ID, len(peers))
+	copy(out, peers)
+	counts := make(map[peer.ID]uint64, len(out))
+	for _, id := range out {
+		count, ok := n.disc.SlowIndices(id)
+		if !ok {
+			count = n.conf.SLOW_INDICES
+		}
+		counts[id] = count
+	}
+	rand.Shuffle(len(out), func(i, j int) {
+		out[i], out[j] = out[j], out[i]
+	})
+	sort.SliceStable(out, func(i, j int) bool {
+		return counts[out[i]] > counts[out[j]]
+	})
+	return out
+}
+
 func (n *Eth2Node) peersUpdate(slot Slot) {
 	// determine set of subnets we are on
 	subnets := make(map[VerticalIndex]struct{}, n.conf.SLOW_INDICES+n.conf.FAST_INDICES)
@@ -23,8 +49,7 @@ func (n *Eth2Node) peersUpdate(slot Slot) {
 	}
 	// if there's anything we want to change
 	if len(want) > 0 {
-		// find the backbone peer mapping.
-		// TODO: inefficient local re-computation. Can be cached or partial data may be enough.
+		// find the backbone peer mapping, cached and incrementally updated by discovery.
 		backbone := n.disc.FindPublic(&n.conf, slot, want)
 		for subnet := range want {
 			// complement with whatever peers we can find in the backbone and we're not connected to already
@@ -38,28 +63,7 @@ func (n *Eth2Node) peersUpdate(slot Slot) {
 			//  However: seems more fragile, more complex, and lessens our chance of having sufficient peers after future rotations,
 			//  since we rotate out the need for the majority of current peers, and left with little.
 
-			dials := uint64(0)
-			// TODO: could shuffle backbone peers, but should be mostly random already anyway.
-			for _, id := range backbonePeers {
-				if id == n.h.ID() { // don't dial ourselves.
-					continue
-				}
-				if currentPeerCount+dials >= n.conf.TARGET_PEERS_PER_DAS_SUB {
-					break
-				}
-				switch n.h.Network().Connectedness(id) {
-				case network.Connected, network.CannotConnect:
-					continue
-				case network.NotConnected, network.CanConnect:
-					// try connect to them
-					select { // try to schedule a dial, but too many may already be queued, in which case we skip.
-					case n.dialReq <- id:
-						dials++
-					default:
-						break
-					}
-				}
-			}
+			dials := uint64(len(n.dialBackbonePeers(backbonePeers, currentPeerCount)))
 			if currentPeerCount+dials < n.conf.TARGET_PEERS_PER_DAS_SUB {
 				n.log.With("topic_peers", currentPeerCount, "dials", dials).Warn("failed to find enough peers to get target")
 				break
@@ -68,6 +72,131 @@ func (n *Eth2Node) peersUpdate(slot Slot) {
 	}
 }
 
+// dialBackbonePeers schedules dials to the given backbone peers that we are not connected to yet,
+// until the current peer count plus the dials reaches TARGET_PEERS_PER_DAS_SUB. Returns the peers that dials were scheduled for.
+func (n *Eth2Node) dialBackbonePeers(backbonePeers []peer.ID, currentPeerCount uint64) (dialed []peer.ID) {
+	for _, id := range n.preferSuperNodes(backbonePeers) {
+		if id == n.h.ID() { // don't dial ourselves.
+			continue
+		}
+		if currentPeerCount+uint64(len(dialed)) >= n.conf.TARGET_PEERS_PER_DAS_SUB {
+			break
+		}
+		switch n.h.Network().Connectedness(id) {
+		case network.Connected, network.CannotConnect:
+			continue
+		case network.NotConnected, network.CanConnect:
+			// try connect to them
+			select { // try to schedule a dial, but too many may already be queued, in which case we skip.
+			case n.dialReq <- id:
+				dialed = append(dialed, id)
+			default:
+			}
+		}
+	}
+	return dialed
+}
+
+// Connection manager protection tag of the backbone peers of upcoming SLOW_INDICES subnets
+const lookaheadProtectTag = "das_slow_lookahead"
+
+// protectUntil protects the peer from connection manager trimming, until after the given switch slot.
+func (n *Eth2Node) protectUntil(id peer.ID, switchSlot Slot) {
+	if until, ok := n.lookaheadProtected[id]; ok && until >= switchSlot {
+		return
+	}
+	n.h.ConnManager().Protect(id, lookaheadProtectTag)
+	n.lookaheadProtected[id] = switchSlot
+}
+
+// unprotectSwitched removes the protection of the lookahead peers of which the switch slot passed.
+// After the switch the peers are regular subnet peers, which gossipsub keeps busy.
+func (n *Eth2Node) unprotectSwitched(slot Slot) {
+	for id, until := range n.lookaheadProtected {
+		if until < slot {
+			n.h.ConnManager().Unprotect(id, lookaheadProtectTag)
+			delete(n.lookaheadProtected, id)
+		}
+	}
+}
+
+// slowPeersLookahead prepares the peering of the SLOW_INDICES subnets that we rotate to within SLOW_SUBNET_LOOKAHEAD_SLOTS.
+// The backbone of such a subnet at the time of the switch is predictable, so we can connect to it in advance,
+// instead of starting with an under-peered subnet after the switch.
+// These peers are not on any of our topics yet, so they are protected from connection manager trimming until the switch.
+func (n *Eth2Node) slowPeersLookahead(slot Slot) {
+	n.unprotectSwitched(slot)
+	if n.conf.SLOW_SUBNET_LOOKAHEAD_SLOTS == 0 {
+		return
+	}
+	future := slot + Slot(n.conf.SLOW_SUBNET_LOOKAHEAD_SLOTS)
+	upcoming := make(map[VerticalIndex]struct{})
+	for subnet := range n.publicDasSubset(future) {
+		// subnets that we are on already are taken care of by peersUpdate
+		if _, ok := n.slowIndices[subnet]; ok {
+			continue
+		}
+		if _, ok := n.fastIndices[subnet]; ok {
+			continue
+		}
+		upcoming[subnet] = struct{}{}
+	}
+	if len(upcoming) == 0 {
+		return
+	}
+	backbone := n.disc.FindPublic(&n.conf, future, upcoming)
+	for subnet := range upcoming {
+		backbonePeers := backbone[subnet]
+		// We are not on the topic yet, so count the connected peers that will be on the subnet at the switch.
+		currentPeerCount := uint64(0)
+		for _, id := range backbonePeers {
+			if id != n.h.ID() && n.h.Network().Connectedness(id) == network.Connected {
+				n.protectUntil(id, future)
+				currentPeerCount++
+			}
+		}
+		dialed := n.dialBackbonePeers(backbonePeers, currentPeerCount)
+		for _, id := range dialed {
+			n.protectUntil(id, future)
+		}
+		dials := uint64(len(dialed))
+		if currentPeerCount+dials < n.conf.TARGET_PEERS_PER_DAS_SUB {
+			n.log.With("subnet", subnet, "switch_slot", future, "backbone_peers", currentPeerCount, "dials", dials).Debug("failed to find enough peers for upcoming subnet")
+		}
+	}
+}
+
+// horzPeersUpdate looks for more peers on the given horizontal subnets, if there are not enough already,
+// by dialing the nodes of the validators in the committee of each shard.
+func (n *Eth2Node) horzPeersUpdate(committees map[Shard][]ValidatorIndex) {
+	for shard, committee := range committees {
+		currentPeerCount := uint64(len(n.ps.ListPeers(n.conf.HorzTopic(shard))))
+		if currentPeerCount >= n.conf.TARGET_PEERS_PER_DAS_SUB {
+			continue
+		}
+		dials := uint64(0)
+		for _, id := range n.disc.FindCommitteePeers(committee) {
+			if id == n.h.ID() { // don't dial ourselves.
+				continue
+			}
+			if currentPeerCount+dials >= n.conf.TARGET_PEERS_PER_DAS_SUB {
+				break
+			}
+			switch n.h.Network().Connectedness(id) {
+			case network.NotConnected, network.CanConnect:
+				select { // try to schedule a dial, but too many may already be queued, in which case we skip.
+				case n.dialReq <- id:
+					dials++
+				default:
+				}
+			}
+		}
+		if currentPeerCount+dials < n.conf.TARGET_PEERS_PER_DAS_SUB {
+			n.log.With("shard", shard, "topic_peers", currentPeerCount, "dials", dials).Warn("failed to find enough committee peers to get target")
+		}
+	}
+}
+
 // TODO: using the connection-manager tagging mechanism, we could:
 // - tag peers with their subnet user labels
 // - protect/unprotect peers that are on the same subnets as we like to have
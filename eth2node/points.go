@@ -3,17 +3,37 @@ package eth2node
 import (
 	"fmt"
 	verkle "github.com/protolambda/go-verkle"
-	"github.com/protolambda/ztyp/tree"
+	"math/big"
+	"math/bits"
 )
 
+// BLS curve order, points must be smaller than this
+var pointModulus, _ = new(big.Int).SetString("52435875175126190479447740508185965837690552500527637822603658699938581184513", 10)
+
+// IsCanonicalPoint checks if the little-endian encoded full point is a valid field element, i.e. smaller than the modulus.
+func IsCanonicalPoint(raw []byte) bool {
+	if len(raw) != BYTES_PER_FULL_POINT {
+		return false
+	}
+	var bigEndian [BYTES_PER_FULL_POINT]byte
+	for i := 0; i < BYTES_PER_FULL_POINT; i++ {
+		bigEndian[i] = raw[BYTES_PER_FULL_POINT-1-i]
+	}
+	return new(big.Int).SetBytes(bigEndian[:]).Cmp(pointModulus) < 0
+}
+
 func (c *ExpandedConfig) MakeSamples(data ShardBlockData) ([]ShardBlockDataChunk, error) {
 	dataPoints, err := c.shardDataToPoints(data)
 	if err != nil {
 		return nil, err
 	}
-	sampleCount := uint64(len(dataPoints)) / c.POINTS_PER_SAMPLE
-	if sampleCount*c.POINTS_PER_SAMPLE != uint64(len(dataPoints)) {
-		return nil, fmt.Errorf("bad data-points count %d, expected it to be divisible by sample chunk size: %d", len(dataPoints), c.POINTS_PER_SAMPLE)
+	return c.pointsToSamples(dataPoints)
+}
+
+func (c *ExpandedConfig) pointsToSamples(points []Point) ([]ShardBlockDataChunk, error) {
+	sampleCount := uint64(len(points)) / c.POINTS_PER_SAMPLE
+	if sampleCount*c.POINTS_PER_SAMPLE != uint64(len(points)) {
+		return nil, fmt.Errorf("bad data-points count %d, expected it to be divisible by sample chunk size: %d", len(points), c.POINTS_PER_SAMPLE)
 	}
 	if sampleCount > c.SAMPLE_SUBNETS {
 		return nil, fmt.Errorf("too many samples: %d, expected no mora than vertical subnet count: %d", sampleCount, c.SAMPLE_SUBNETS)
@@ -23,7 +43,7 @@ func (c *ExpandedConfig) MakeSamples(data ShardBlockData) ([]ShardBlockDataChunk
 		start := i * c.POINTS_PER_SAMPLE
 		sample := make(ShardBlockDataChunk, c.POINTS_PER_SAMPLE*BYTES_PER_FULL_POINT)
 		for j := uint64(0); j < c.POINTS_PER_SAMPLE; j++ {
-			p := &dataPoints[start+j]
+			p := &points[start+j]
 			raw := verkle.BigNumTo32(p)
 			copy(sample[j*BYTES_PER_FULL_POINT:(j+1)*BYTES_PER_FULL_POINT], raw[:])
 		}
@@ -32,6 +52,47 @@ func (c *ExpandedConfig) MakeSamples(data ShardBlockData) ([]ShardBlockDataChunk
 	return out, nil
 }
 
+// RecoverSamples rebuilds all MAX_SAMPLES_PER_SHARD_BLOCK samples of the extended data,
+// given at least half of them. The samples are keyed by their index in the extended data.
+func (c *ExpandedConfig) RecoverSamples(samples map[SampleIndex]ShardBlockDataChunk) ([]ShardBlockDataChunk, error) {
+	extended, err := c.recoverSamplePoints(samples)
+	if err != nil {
+		return nil, err
+	}
+	return c.pointsToSamples(extended)
+}
+
+// recoverSamplePoints is like RecoverSamples, but returns the recovered extended points.
+func (c *ExpandedConfig) recoverSamplePoints(samples map[SampleIndex]ShardBlockDataChunk) ([]Point, error) {
+	sampleCount := c.MAX_SAMPLES_PER_SHARD_BLOCK
+	if uint64(len(samples))*2 < sampleCount {
+		return nil, fmt.Errorf("too few samples to recover from: got %d, need at least %d out of %d", len(samples), (sampleCount+1)/2, sampleCount)
+	}
+	width := sampleCount * c.POINTS_PER_SAMPLE
+	vals := make([]*Point, width, width)
+	for index, sample := range samples {
+		if uint64(index) >= sampleCount {
+			return nil, fmt.Errorf("sample index %d is out of range, expected less than %d", index, sampleCount)
+		}
+		if uint64(len(sample)) != c.POINTS_PER_SAMPLE*BYTES_PER_FULL_POINT {
+			return nil, fmt.Errorf("sample %d has bad length %d, expected %d", index, len(sample), c.POINTS_PER_SAMPLE*BYTES_PER_FULL_POINT)
+		}
+		start := uint64(index) * c.POINTS_PER_SAMPLE
+		for j := uint64(0); j < c.POINTS_PER_SAMPLE; j++ {
+			var raw [BYTES_PER_FULL_POINT]byte
+			copy(raw[:], sample[j*BYTES_PER_FULL_POINT:(j+1)*BYTES_PER_FULL_POINT])
+			p := new(Point)
+			verkle.BigNumFrom32(p, raw)
+			vals[start+j] = p
+		}
+	}
+	extended, err := recoverPoints(vals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover samples: %v", err)
+	}
+	return extended, nil
+}
+
 func (c *ExpandedConfig) shardDataToPoints(input []byte) ([]Point, error) {
 	l := uint64(len(input))
 	if l > c.MAX_DATA_SIZE {
@@ -40,11 +101,13 @@ func (c *ExpandedConfig) shardDataToPoints(input []byte) ([]Point, error) {
 	// round up
 	inputPoints := (l + BYTES_PER_DATA_POINT - 1) / BYTES_PER_DATA_POINT
 
-	// Get depth of next power of 2 (if not already)
-	// Example (in, out):
-	// (0 0), (1 0), (2 1), (3 2), (4 2), (5 3), (6 3), (7 3), (8 3), (9 4)
-	inputDepth := tree.CoverDepth(inputPoints)
-	inputPointsPaddedLen := uint64(1) << inputDepth
+	// Always pad to the full width: every shard block extends to the same MAX_SAMPLES_PER_SHARD_BLOCK samples,
+	// so small blocks commit, prove, sample and recover like full blocks.
+	inputPointsPaddedLen := c.MAX_SAMPLES_PER_SHARD_BLOCK * c.POINTS_PER_SAMPLE / 2
+	if inputPointsPaddedLen == 0 || inputPointsPaddedLen&(inputPointsPaddedLen-1) != 0 {
+		return nil, fmt.Errorf("extended points count must be a power of two, and at least 2, got %d", inputPointsPaddedLen*2)
+	}
+	inputDepth := uint8(bits.Len64(inputPointsPaddedLen) - 1)
 
 	changedOrder := reverseBitOrder(inputPointsPaddedLen)
 	points := make([]Point, inputPointsPaddedLen, inputPointsPaddedLen)
@@ -82,6 +145,57 @@ func (c *ExpandedConfig) shardDataToPoints(input []byte) ([]Point, error) {
 	return extended, nil
 }
 
+// UnextendPoints takes the extended points, as produced by shardDataToPoints,
+// and returns the original (padded) points in regular order.
+// The odd-index points are the extension, and are dropped.
+// The even-index points are the inputs in reverse-bit-order, and are put back in order.
+func (c *ExpandedConfig) UnextendPoints(extended []Point) ([]Point, error) {
+	extendedLength := uint64(len(extended))
+	if extendedLength < 2 || extendedLength&(extendedLength-1) != 0 {
+		return nil, fmt.Errorf("extended points count must be a power of two, and at least 2, got %d", extendedLength)
+	}
+	inputPointsPaddedLen := extendedLength / 2
+	changedOrder := reverseBitOrder(inputPointsPaddedLen)
+	out := make([]Point, inputPointsPaddedLen, inputPointsPaddedLen)
+	for i := uint64(0); i < inputPointsPaddedLen; i++ {
+		// the even points are the inputs, in reverse-bit-order
+		verkle.CopyBigNum(&out[i], &extended[changedOrder[i]<<1])
+	}
+	return out, nil
+}
+
+// PointsToShardData is the inverse of shardDataToPoints: it unextends the points,
+// strips the 32nd byte of each point (which must be zero for data points),
+// and trims the zero padding, to get back the original size bytes of shard data.
+func (c *ExpandedConfig) PointsToShardData(extended []Point, size uint64) (ShardBlockData, error) {
+	if size > c.MAX_DATA_SIZE {
+		return nil, fmt.Errorf("data size is too large: %d bytes, expected no more than %d", size, c.MAX_DATA_SIZE)
+	}
+	points, err := c.UnextendPoints(extended)
+	if err != nil {
+		return nil, err
+	}
+	capacity := uint64(len(points)) * BYTES_PER_DATA_POINT
+	if size > capacity {
+		return nil, fmt.Errorf("data size %d does not fit in %d points", size, len(points))
+	}
+	out := make(ShardBlockData, capacity, capacity)
+	for i := range points {
+		raw := verkle.BigNumTo32(&points[i])
+		if raw[BYTES_PER_DATA_POINT] != 0 {
+			return nil, fmt.Errorf("point %d is not a data point, last byte is %d", i, raw[BYTES_PER_DATA_POINT])
+		}
+		copy(out[i*BYTES_PER_DATA_POINT:(i+1)*BYTES_PER_DATA_POINT], raw[:BYTES_PER_DATA_POINT])
+	}
+	// anything beyond the size is padding, and must be zero
+	for i := size; i < capacity; i++ {
+		if out[i] != 0 {
+			return nil, fmt.Errorf("expected zero padding after %d bytes, but byte %d is %d", size, i, out[i])
+		}
+	}
+	return out[:size], nil
+}
+
 func reverseBitOrder(width uint64) []uint64 {
 	order := make([]uint64, width, width)
 	for i := uint64(0); i < width; i++ {
@@ -0,0 +1,96 @@
+package eth2node
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func testPointsConfig() ExpandedConfig {
+	conf := &Config{
+		FAST_INDICES:                4,
+		SLOW_INDICES:                2,
+		MAX_SAMPLES_PER_SHARD_BLOCK: 16,
+		POINTS_PER_SAMPLE:           16,
+		SHARD_COUNT:                 4,
+	}
+	return conf.Expand()
+}
+
+func TestPointsToShardData(t *testing.T) {
+	conf := testPointsConfig()
+	rng := rand.New(rand.NewSource(123))
+	for _, size := range []uint64{40, 62, 63, 100, conf.MAX_DATA_SIZE - 1, conf.MAX_DATA_SIZE} {
+		data := make([]byte, size, size)
+		rng.Read(data)
+		points, err := conf.shardDataToPoints(data)
+		if err != nil {
+			t.Fatalf("size %d: failed to make points: %v", size, err)
+		}
+		// any size is padded to the full width
+		if width := conf.MAX_SAMPLES_PER_SHARD_BLOCK * conf.POINTS_PER_SAMPLE; uint64(len(points)) != width {
+			t.Fatalf("size %d: expected %d extended points, got %d", size, width, len(points))
+		}
+		out, err := conf.PointsToShardData(points, size)
+		if err != nil {
+			t.Fatalf("size %d: failed to get data back from points: %v", size, err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Fatalf("size %d: data does not match:\n%x\n%x", size, data, []byte(out))
+		}
+	}
+}
+
+func TestRecoverSamples(t *testing.T) {
+	conf := testPointsConfig()
+	rng := rand.New(rand.NewSource(456))
+	// small blocks extend to the same width as full blocks, and recover the same way
+	for _, size := range []uint64{100, conf.MAX_DATA_SIZE / 2, conf.MAX_DATA_SIZE} {
+		data := make([]byte, size, size)
+		rng.Read(data)
+		samples, err := conf.MakeSamples(data)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if uint64(len(samples)) != conf.MAX_SAMPLES_PER_SHARD_BLOCK {
+			t.Fatalf("size %d: expected %d samples, got %d", size, conf.MAX_SAMPLES_PER_SHARD_BLOCK, len(samples))
+		}
+		// keep a random half of the samples
+		partial := make(map[SampleIndex]ShardBlockDataChunk)
+		for _, i := range rng.Perm(len(samples))[:len(samples)/2] {
+			partial[SampleIndex(i)] = samples[i]
+		}
+		recovered, err := conf.RecoverSamples(partial)
+		if err != nil {
+			t.Fatalf("size %d: failed to recover: %v", size, err)
+		}
+		if len(recovered) != len(samples) {
+			t.Fatalf("size %d: expected %d samples, got %d", size, len(samples), len(recovered))
+		}
+		for i := range samples {
+			if !bytes.Equal(samples[i], recovered[i]) {
+				t.Fatalf("size %d: recovered sample %d does not match", size, i)
+			}
+		}
+		points, err := conf.recoverSamplePoints(partial)
+		if err != nil {
+			t.Fatalf("size %d: failed to recover points: %v", size, err)
+		}
+		out, err := conf.PointsToShardData(points, size)
+		if err != nil {
+			t.Fatalf("size %d: failed to get data back from recovered points: %v", size, err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Fatalf("size %d: recovered data does not match", size)
+		}
+
+		// one less than half is not enough
+		for k := range partial {
+			delete(partial, k)
+			break
+		}
+		if _, err := conf.RecoverSamples(partial); err == nil {
+			t.Fatalf("size %d: expected error when recovering from too few samples", size)
+		}
+	}
+}
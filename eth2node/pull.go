@@ -0,0 +1,104 @@
+package eth2node
+
+import (
+	"bytes"
+	"context"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/protolambda/ztyp/codec"
+	"go.uber.org/zap"
+	"math/rand"
+	"time"
+)
+
+// pullMissingSamples is called at the PULL_DEADLINE of each slot.
+// Any expected sample that did not arrive on the vertical subnets yet is requested from backbone peers of the subnet,
+// up until the AVAILABILITY_DEADLINE.
+func (n *Eth2Node) pullMissingSamples(slot Slot) {
+	missing := n.availability.missing(slot, func(shard Shard) []SampleIndex {
+		return n.expectedSamples(slot, shard)
+	})
+	if len(missing) == 0 {
+		return
+	}
+	subnets := make(map[VerticalIndex]struct{})
+	for _, m := range missing {
+		subnets[n.conf.SampleSubnet(slot, m.shard, m.index)] = struct{}{}
+	}
+	backbone := n.disc.FindPublic(&n.conf, slot, subnets)
+	ctx, cancel := context.WithDeadline(n.subProcesses.ctx, n.conf.slotStart(slot).Add(n.conf.AVAILABILITY_DEADLINE))
+	defer cancel()
+	n.log.With("slot", slot, "missing", len(missing)).Debug("pulling missing samples")
+
+	done := make(chan struct{}, len(missing))
+	for _, m := range missing {
+		go func(m missingSample) {
+			n.pullSample(ctx, slot, m, backbone[n.conf.SampleSubnet(slot, m.shard, m.index)])
+			done <- struct{}{}
+		}(m)
+	}
+	for range missing {
+		<-done
+	}
+}
+
+// pullSample requests the missing sample from up to PULL_PEERS of the given peers in parallel,
+// and records the first valid answer.
+func (n *Eth2Node) pullSample(ctx context.Context, slot Slot, m missingSample, peers []peer.ID) {
+	candidates := make([]peer.ID, 0, len(peers))
+	for _, p := range peers {
+		if p != n.h.ID() {
+			candidates = append(candidates, p)
+		}
+	}
+	if len(candidates) == 0 {
+		n.log.With("slot", slot, "shard", m.shard, "index", m.index).Debug("no backbone peers to pull missing sample from")
+		return
+	}
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	if uint64(len(candidates)) > n.conf.PULL_PEERS {
+		candidates = candidates[:n.conf.PULL_PEERS]
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan *DASSample, len(candidates))
+	for _, p := range candidates {
+		go func(p peer.ID) {
+			// the backbone peer may not be connected yet
+			n.h.Peerstore().AddAddrs(p, n.disc.Addrs(p), peerstore.TempAddrTTL)
+			samples, err := n.RequestSamples(ctx, p, slot, m.shard, []SampleIndex{m.index})
+			if ctx.Err() != nil { // another peer was first, or out of time
+				results <- nil
+				return
+			}
+			if err != nil {
+				n.log.With("peer", p, "slot", slot, "shard", m.shard, zap.Error(err)).Debug("failed to pull sample")
+			}
+			for _, s := range samples {
+				// the peer may know of a different header of the same proposal
+				if s.ShardHeaderRoot == m.headerRoot {
+					n.availability.countPullRequest(true)
+					results <- s
+					return
+				}
+			}
+			n.availability.countPullRequest(false)
+			results <- nil
+		}(p)
+	}
+	for range candidates {
+		if sample := <-results; sample != nil {
+			n.availability.addSample(slot, m.headerRoot, m.index, SampleReceipt{At: time.Now(), Pulled: true})
+			var buf bytes.Buffer
+			if err := sample.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+				n.log.With(zap.Error(err)).Error("failed to encode pulled sample")
+				return
+			}
+			n.storeSample(sample, buf.Bytes())
+			return
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package eth2node
+
+import (
+	"fmt"
+	verkle "github.com/protolambda/go-verkle"
+	"math/bits"
+)
+
+// Any value that is not a root of unity works to shift the evaluation domain with.
+// The shift avoids divisions by zero when dividing out the zero polynomial.
+const recoveryShiftFactor = 5
+
+// recoverPoints recovers all extended points, given any half (or more) of them.
+// Missing points are nil. The number of points must be a power of two.
+//
+// This is the FFT-based Reed-Solomon erasure code recovery:
+//  1. Construct the zero polynomial Z, which is zero for each of the missing points.
+//  2. Evaluate (E*Z)(x), which is zero for each missing point, and E(x)*Z(x) for each known point.
+//  3. Shift both (E*Z) and Z to a coset of the domain, where Z does not evaluate to zero.
+//  4. Divide (E*Z) by Z in evaluation form, and shift the resulting E back, to get all points.
+func recoverPoints(vals []*Point) ([]Point, error) {
+	width := uint64(len(vals))
+	if width < 2 || width&(width-1) != 0 {
+		return nil, fmt.Errorf("points count must be a power of two, and at least 2, got %d", width)
+	}
+	missing := uint64(0)
+	for _, v := range vals {
+		if v == nil {
+			missing++
+		}
+	}
+	if missing > width/2 {
+		return nil, fmt.Errorf("too many points missing: %d, cannot recover more than %d out of %d", missing, width/2, width)
+	}
+
+	fs := verkle.NewFFTSettings(uint8(bits.Len64(width) - 1))
+
+	// Z(x) = product of (x - w^i) for each missing point i
+	zeroPoly := make([]Point, width, width)
+	for i := range zeroPoly {
+		verkle.CopyBigNum(&zeroPoly[i], &verkle.ZERO)
+	}
+	verkle.CopyBigNum(&zeroPoly[0], &verkle.ONE)
+	degree := 0
+	for i, v := range vals {
+		if v != nil {
+			continue
+		}
+		root := &fs.ExpandedRootsOfUnity[i]
+		degree++
+		// multiply by (x - root), starting at the highest coefficient, to use the previous lower coefficient.
+		var tmp Point
+		for k := degree; k > 0; k-- {
+			verkle.MulModBig(&tmp, &zeroPoly[k], root)
+			verkle.SubModBig(&zeroPoly[k], &zeroPoly[k-1], &tmp)
+		}
+		verkle.MulModBig(&tmp, &zeroPoly[0], root)
+		verkle.SubModBig(&zeroPoly[0], &verkle.ZERO, &tmp)
+	}
+
+	zeroEval, err := fs.FFT(zeroPoly, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate zero polynomial: %v", err)
+	}
+
+	// (E*Z)(x), in evaluation form
+	polyWithZero := make([]Point, width, width)
+	for i, v := range vals {
+		if v == nil {
+			verkle.CopyBigNum(&polyWithZero[i], &verkle.ZERO)
+		} else {
+			verkle.MulModBig(&polyWithZero[i], v, &zeroEval[i])
+		}
+	}
+	polyWithZeroCoeffs, err := fs.FFT(polyWithZero, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get (E*Z) coefficients: %v", err)
+	}
+
+	// shift both polynomials: p(x) -> p(k*x)
+	var shiftFactor, invShiftFactor Point
+	verkle.AsBig(&shiftFactor, recoveryShiftFactor)
+	verkle.InvModBig(&invShiftFactor, &shiftFactor)
+	shiftPoly(polyWithZeroCoeffs, &shiftFactor)
+	shiftPoly(zeroPoly, &shiftFactor)
+
+	shiftedPolyWithZeroEval, err := fs.FFT(polyWithZeroCoeffs, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate shifted (E*Z): %v", err)
+	}
+	shiftedZeroEval, err := fs.FFT(zeroPoly, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate shifted Z: %v", err)
+	}
+
+	// E(k*x) = (E*Z)(k*x) / Z(k*x)
+	shiftedEval := make([]Point, width, width)
+	for i := uint64(0); i < width; i++ {
+		verkle.DivModBig(&shiftedEval[i], &shiftedPolyWithZeroEval[i], &shiftedZeroEval[i])
+	}
+	coeffs, err := fs.FFT(shiftedEval, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shifted E coefficients: %v", err)
+	}
+	shiftPoly(coeffs, &invShiftFactor)
+
+	// the data is only extended if the second half of the coefficients are zero
+	for i := width / 2; i < width; i++ {
+		if !verkle.EqualZero(&coeffs[i]) {
+			return nil, fmt.Errorf("recovered polynomial is too high degree, coefficient %d is not zero", i)
+		}
+	}
+
+	out, err := fs.FFT(coeffs, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate recovered polynomial: %v", err)
+	}
+	for i, v := range vals {
+		if v != nil && !verkle.EqualBig(v, &out[i]) {
+			return nil, fmt.Errorf("recovered point %d does not match the original", i)
+		}
+	}
+	return out, nil
+}
+
+// shiftPoly multiplies each coefficient i with factor^i, in-place.
+func shiftPoly(coeffs []Point, factor *Point) {
+	var factorPower, tmp Point
+	verkle.CopyBigNum(&factorPower, &verkle.ONE)
+	for i := range coeffs {
+		verkle.MulModBig(&tmp, &coeffs[i], &factorPower)
+		verkle.CopyBigNum(&coeffs[i], &tmp)
+		verkle.MulModBig(&tmp, &factorPower, factor)
+		verkle.CopyBigNum(&factorPower, &tmp)
+	}
+}
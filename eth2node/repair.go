@@ -0,0 +1,245 @@
+package eth2node
+
+import (
+	"context"
+	"fmt"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"go.uber.org/zap"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RepairStats counts the work of a repairer
+type RepairStats struct {
+	// Shard blocks that were recovered from their samples
+	Recovered uint64
+	// Recovered samples that were published, because they were not seen on the vertical subnets
+	RepairedSamples uint64
+	// Recovered samples that were not seen on the vertical subnets, but failed to publish, e.g. because of a timeout
+	UnpublishedSamples uint64
+	// Shard blocks that could not be recovered
+	Failures uint64
+}
+
+type repairBlock struct {
+	slot  Slot
+	shard Shard
+	// received samples, by sample index
+	samples map[SampleIndex]ShardBlockDataChunk
+	// true when the recovery is scheduled (or done)
+	scheduled bool
+}
+
+// repairer collects the samples of shard blocks, to recover and republish any missing samples.
+type repairer struct {
+	sync.Mutex
+	// shard -> sample indices that are listened for
+	shards map[Shard][]SampleIndex
+	// subscriptions to the vertical subnets of the listened samples, updated every slot
+	subs   map[VerticalIndex]*pubsub.Subscription
+	blocks map[Root]*repairBlock
+	stats  RepairStats
+}
+
+func newRepairer() *repairer {
+	return &repairer{
+		shards: make(map[Shard][]SampleIndex),
+		subs:   make(map[VerticalIndex]*pubsub.Subscription),
+		blocks: make(map[Root]*repairBlock),
+	}
+}
+
+// EnableRepairer makes the node listen for REPAIR_FRACTION of the samples of each shard block of the given shards.
+// Once more than half the samples of a shard block are received, and after the REPAIR_DELAY,
+// the node recovers the shard block data, and publishes any recovered sample it did not see on the vertical subnets.
+// Samples of the subnets the repairer does not listen on are considered missing, and are published too.
+func (n *Eth2Node) EnableRepairer(shards ...Shard) error {
+	sampleCount := n.conf.MAX_SAMPLES_PER_SHARD_BLOCK
+	listenCount := uint64(math.Ceil(n.conf.REPAIR_FRACTION * float64(sampleCount)))
+	if listenCount*2 <= sampleCount || listenCount > sampleCount {
+		return fmt.Errorf("repair fraction %f does not cover more than half of the samples", n.conf.REPAIR_FRACTION)
+	}
+	r := n.repair
+	r.Lock()
+	for _, shard := range shards {
+		if uint64(shard) >= n.conf.SHARD_COUNT {
+			r.Unlock()
+			return fmt.Errorf("invalid shard %d", shard)
+		}
+		if _, ok := r.shards[shard]; ok {
+			continue
+		}
+		// a random selection of samples, different between repairers
+		indices := make([]SampleIndex, 0, listenCount)
+		for _, i := range rand.Perm(int(sampleCount))[:listenCount] {
+			indices = append(indices, SampleIndex(i))
+		}
+		r.shards[shard] = indices
+	}
+	r.Unlock()
+	slot, preGenesis := n.conf.SlotNow()
+	if preGenesis {
+		slot = 0
+	}
+	n.updateRepairSubnets(slot)
+	n.log.With("shards", shards, "samples_per_shard", listenCount).Info("enabled repairer")
+	return nil
+}
+
+// updateRepairSubnets subscribes to the subnets of the listened samples of the current and next slot,
+// as samples are published ahead of their slot. Called by the main loop every slot.
+func (n *Eth2Node) updateRepairSubnets(slot Slot) {
+	r := n.repair
+	r.Lock()
+	defer r.Unlock()
+	want := make(map[VerticalIndex]struct{})
+	for shard, indices := range r.shards {
+		for _, i := range indices {
+			want[n.conf.SampleSubnet(slot, shard, i)] = struct{}{}
+			want[n.conf.SampleSubnet(slot+1, shard, i)] = struct{}{}
+		}
+	}
+	for subnet, sub := range r.subs {
+		if _, ok := want[subnet]; !ok {
+			sub.Cancel()
+			delete(r.subs, subnet)
+		}
+	}
+	for subnet := range want {
+		if _, ok := r.subs[subnet]; ok {
+			continue
+		}
+		sub, err := n.verticalSubnets[subnet].Subscribe()
+		if err != nil {
+			n.log.With(zap.Error(err)).With("subnet", subnet).Error("failed to subscribe to vertical subnet for repairs")
+			continue
+		}
+		r.subs[subnet] = sub
+		go n.repairHandleSubnet(subnet, sub)
+	}
+}
+
+// repairHandleSubnet drains the repairer subscription.
+// Samples are collected during validation, to not process them twice if the subnet is also sampled.
+func (n *Eth2Node) repairHandleSubnet(index VerticalIndex, sub *pubsub.Subscription) {
+	for {
+		if _, err := sub.Next(n.subProcesses.ctx); err != nil {
+			if err == n.subProcesses.ctx.Err() {
+				return
+			}
+			if err == pubsub.ErrSubscriptionCancelled || err == pubsub.ErrTopicClosed {
+				return
+			}
+			n.log.With(zap.Error(err)).With("subnet", index).Error("failed to read from repair subnet subscription")
+			sub.Cancel()
+			return
+		}
+	}
+}
+
+// repairSample collects a validated sample, and schedules the recovery of its shard block once it has enough samples.
+func (n *Eth2Node) repairSample(headerRoot Root, header *ShardBlockHeader, sampleIndex SampleIndex, sample ShardBlockDataChunk) {
+	r := n.repair
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.shards[header.Shard]; !ok {
+		return
+	}
+	block, ok := r.blocks[headerRoot]
+	if !ok {
+		block = &repairBlock{slot: header.Slot, shard: header.Shard, samples: make(map[SampleIndex]ShardBlockDataChunk)}
+		r.blocks[headerRoot] = block
+	}
+	block.samples[sampleIndex] = sample
+	if !block.scheduled && uint64(len(block.samples))*2 > n.conf.MAX_SAMPLES_PER_SHARD_BLOCK {
+		block.scheduled = true
+		time.AfterFunc(n.conf.REPAIR_DELAY, func() {
+			n.repairBlock(headerRoot)
+		})
+	}
+}
+
+// repairBlock recovers the shard block data, and publishes the missing samples.
+func (n *Eth2Node) repairBlock(headerRoot Root) {
+	r := n.repair
+	r.Lock()
+	block, ok := r.blocks[headerRoot]
+	if !ok { // pruned already
+		r.Unlock()
+		return
+	}
+	samples := make(map[SampleIndex]ShardBlockDataChunk, len(block.samples))
+	for i, sample := range block.samples {
+		samples[i] = sample
+	}
+	r.Unlock()
+
+	if uint64(len(samples)) == n.conf.MAX_SAMPLES_PER_SHARD_BLOCK {
+		return // nothing is missing
+	}
+	if err := n.recoverAndRepublish(headerRoot, block.slot, block.shard, samples); err != nil {
+		n.log.With(zap.Error(err)).With("slot", block.slot, "shard", block.shard).Warn("failed to repair shard block")
+		r.Lock()
+		r.stats.Failures += 1
+		r.Unlock()
+	}
+}
+
+func (n *Eth2Node) recoverAndRepublish(headerRoot Root, slot Slot, shard Shard, samples map[SampleIndex]ShardBlockDataChunk) error {
+	signedHeader := n.headers.get(headerRoot)
+	if signedHeader == nil {
+		return fmt.Errorf("header was pruned")
+	}
+	points, err := n.conf.recoverSamplePoints(samples)
+	if err != nil {
+		return err
+	}
+	commitment, proofs, err := n.kate.ProveSamples(points)
+	if err != nil {
+		return fmt.Errorf("failed to prove recovered samples: %v", err)
+	}
+	if commitment != signedHeader.Message.BodyCommitment {
+		return fmt.Errorf("recovered data does not match header commitment")
+	}
+	msgs, err := n.makeDASSamples(slot, shard, headerRoot, points, proofs)
+	if err != nil {
+		return fmt.Errorf("failed to make samples: %v", err)
+	}
+	slotDuration := time.Second * time.Duration(n.conf.SECONDS_PER_SLOT)
+	ctx, cancel := context.WithTimeout(n.subProcesses.ctx, slotDuration)
+	defer cancel()
+	repaired, unpublished := n.publishSamples(ctx, msgs, func(msg *DASSample) bool {
+		if _, ok := samples[msg.SampleIndex]; ok {
+			return false
+		}
+		return !n.seenSamples.has(sampleSeenKey{headerRoot: msg.ShardHeaderRoot, index: msg.SampleIndex})
+	})
+	// recorded after publishing, so samples that failed to publish do not count as repaired
+	r := n.repair
+	r.Lock()
+	r.stats.Recovered += 1
+	r.stats.RepairedSamples += repaired
+	r.stats.UnpublishedSamples += unpublished
+	r.Unlock()
+	return nil
+}
+
+// prune forgets about shard blocks older than the given slot
+func (r *repairer) prune(minSlot Slot) {
+	r.Lock()
+	defer r.Unlock()
+	for root, block := range r.blocks {
+		if block.slot < minSlot {
+			delete(r.blocks, root)
+		}
+	}
+}
+
+// RepairStats returns the counts of the repairer work so far.
+func (n *Eth2Node) RepairStats() RepairStats {
+	n.repair.Lock()
+	defer n.repair.Unlock()
+	return n.repair.stats
+}
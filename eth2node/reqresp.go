@@ -0,0 +1,306 @@
+package eth2node
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/golang/snappy"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+	"go.uber.org/zap"
+	"io"
+	"time"
+)
+
+const SamplesByIndexProtocol = protocol.ID("/eth2/das/req/samples_by_index/1/ssz_snappy")
+
+// Maximum number of samples in a single samples_by_index request
+const MAX_REQUEST_SAMPLES = 256
+
+// Like in phase 0: the time to wait for the first byte of a response, and the time to wait for each response chunk.
+const TTFB_TIMEOUT = 5 * time.Second
+const RESP_TIMEOUT = 10 * time.Second
+
+// Maximum byte length of an error message in a response chunk
+const maxErrorMessageLength = 256
+
+type respCode uint8
+
+const (
+	respSuccess        respCode = 0
+	respInvalidRequest respCode = 1
+	respServerError    respCode = 2
+)
+
+// SampleIndexList is a list of sample indices, within a shard block.
+type SampleIndexList []SampleIndex
+
+func (p *SampleIndexList) Deserialize(dr *codec.DecodingReader) error {
+	return dr.List(func() codec.Deserializable {
+		i := len(*p)
+		*p = append(*p, 0)
+		return &(*p)[i]
+	}, 8, MAX_REQUEST_SAMPLES)
+}
+
+func (p SampleIndexList) Serialize(w *codec.EncodingWriter) error {
+	return w.List(func(i uint64) codec.Serializable {
+		return p[i]
+	}, 8, uint64(len(p)))
+}
+
+func (p SampleIndexList) ByteLength() uint64 {
+	return 8 * uint64(len(p))
+}
+
+func (p *SampleIndexList) FixedLength() uint64 {
+	return 0
+}
+
+func (p SampleIndexList) HashTreeRoot(hFn tree.HashFn) Root {
+	return hFn.Uint64ListHTR(func(i uint64) uint64 {
+		return uint64(p[i])
+	}, uint64(len(p)), MAX_REQUEST_SAMPLES)
+}
+
+type SamplesByIndexRequest struct {
+	Slot    Slot
+	Shard   Shard
+	Indices SampleIndexList
+}
+
+func (d *SamplesByIndexRequest) Deserialize(dr *codec.DecodingReader) error {
+	return dr.Container(&d.Slot, &d.Shard, &d.Indices)
+}
+
+func (d *SamplesByIndexRequest) Serialize(w *codec.EncodingWriter) error {
+	return w.Container(&d.Slot, &d.Shard, &d.Indices)
+}
+
+func (d *SamplesByIndexRequest) ByteLength() uint64 {
+	return codec.ContainerLength(&d.Slot, &d.Shard, &d.Indices)
+}
+
+func (d *SamplesByIndexRequest) FixedLength() uint64 {
+	return 0
+}
+
+func (d *SamplesByIndexRequest) HashTreeRoot(hFn tree.HashFn) Root {
+	return hFn.HashTreeRoot(&d.Slot, &d.Shard, &d.Indices)
+}
+
+// Byte length of a request with MAX_REQUEST_SAMPLES indices: slot, shard, list offset, and the indices.
+const maxSamplesByIndexRequestLength = 8 + 8 + 4 + 8*MAX_REQUEST_SAMPLES
+
+// writeSnappyChunk writes the length of the data as varint, followed by the data, snappy frame-compressed.
+func writeSnappyChunk(w io.Writer, data []byte) error {
+	var lenBuf [binary.MaxVarintLen64]byte
+	size := binary.PutUvarint(lenBuf[:], uint64(len(data)))
+	if _, err := w.Write(lenBuf[:size]); err != nil {
+		return fmt.Errorf("failed to write chunk length: %w", err)
+	}
+	sw := snappy.NewBufferedWriter(w)
+	if _, err := sw.Write(data); err != nil {
+		return fmt.Errorf("failed to write compressed chunk: %w", err)
+	}
+	// flushes the remaining data, does not close the underlying writer
+	return sw.Close()
+}
+
+// readSnappyChunk reads a chunk as written by writeSnappyChunk, with a limit on the decompressed length.
+func readSnappyChunk(r *bufio.Reader, maxLength uint64) ([]byte, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk length: %w", err)
+	}
+	if length > maxLength {
+		return nil, fmt.Errorf("chunk length %d exceeds limit %d", length, maxLength)
+	}
+	data := make([]byte, length, length)
+	if _, err := io.ReadFull(snappy.NewReader(r), data); err != nil {
+		return nil, fmt.Errorf("failed to read compressed chunk: %w", err)
+	}
+	return data, nil
+}
+
+func writeResponseChunk(w io.Writer, code respCode, data []byte) error {
+	if _, err := w.Write([]byte{byte(code)}); err != nil {
+		return fmt.Errorf("failed to write response code: %w", err)
+	}
+	return writeSnappyChunk(w, data)
+}
+
+func writeErrorResponse(w io.Writer, code respCode, msg string) error {
+	if len(msg) > maxErrorMessageLength {
+		msg = msg[:maxErrorMessageLength]
+	}
+	return writeResponseChunk(w, code, []byte(msg))
+}
+
+func (n *Eth2Node) handleSamplesByIndex(stream network.Stream) {
+	log := n.log.With("peer", stream.Conn().RemotePeer(), "protocol", SamplesByIndexProtocol)
+	_ = stream.SetReadDeadline(time.Now().Add(TTFB_TIMEOUT))
+	data, err := readSnappyChunk(bufio.NewReader(stream), maxSamplesByIndexRequestLength)
+	if err != nil {
+		log.With(zap.Error(err)).Debug("failed to read request")
+		_ = stream.Reset()
+		return
+	}
+	_ = stream.SetWriteDeadline(time.Now().Add(RESP_TIMEOUT))
+	var req SamplesByIndexRequest
+	if err := req.Deserialize(codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data)))); err != nil {
+		log.With(zap.Error(err)).Debug("invalid request")
+		if err := writeErrorResponse(stream, respInvalidRequest, "could not decode request"); err != nil {
+			_ = stream.Reset()
+			return
+		}
+		_ = stream.Close()
+		return
+	}
+	// Only respond with the samples that are available, in order of the request.
+	for _, index := range req.Indices {
+		sample, err := n.samples.Get(SampleKey{Slot: req.Slot, Shard: req.Shard, Index: index})
+		if err == ErrSampleNotFound {
+			continue
+		}
+		if err != nil {
+			log.With(zap.Error(err)).Warn("failed to get sample from store")
+			if err := writeErrorResponse(stream, respServerError, "failed to get sample"); err != nil {
+				_ = stream.Reset()
+				return
+			}
+			break
+		}
+		_ = stream.SetWriteDeadline(time.Now().Add(RESP_TIMEOUT))
+		if err := writeResponseChunk(stream, respSuccess, sample); err != nil {
+			log.With(zap.Error(err)).Debug("failed to write response")
+			_ = stream.Reset()
+			return
+		}
+	}
+	_ = stream.Close()
+}
+
+var errSamplesResponseErr = errors.New("peer responded with error")
+
+// RequestSamples requests the samples with the given indices, of the shard block of the given slot and shard.
+// The peer only responds with the samples it has, so the result may have less samples than requested.
+// Each returned sample is checked against its (known) shard header and proof.
+// An error is returned if the peer responds with an error, or with any invalid sample.
+func (n *Eth2Node) RequestSamples(ctx context.Context, p peer.ID, slot Slot, shard Shard, indices []SampleIndex) ([]*DASSample, error) {
+	if len(indices) > MAX_REQUEST_SAMPLES {
+		return nil, fmt.Errorf("too many indices in request: %d", len(indices))
+	}
+	requested := make(map[SampleIndex]struct{}, len(indices))
+	for _, i := range indices {
+		requested[i] = struct{}{}
+	}
+	req := SamplesByIndexRequest{Slot: slot, Shard: shard, Indices: indices}
+	var buf bytes.Buffer
+	if err := req.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	stream, err := n.h.NewStream(ctx, p, SamplesByIndexProtocol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream: %w", err)
+	}
+	_ = stream.SetWriteDeadline(time.Now().Add(RESP_TIMEOUT))
+	if err := writeSnappyChunk(stream, buf.Bytes()); err != nil {
+		_ = stream.Reset()
+		return nil, fmt.Errorf("failed to write request: %w", err)
+	}
+	// close our side of the stream, to signal the request is complete
+	if err := stream.Close(); err != nil {
+		_ = stream.Reset()
+		return nil, fmt.Errorf("failed to close request: %w", err)
+	}
+
+	// the requested set shrinks as samples are accepted, the response is limited by the original count.
+	requestCount := len(requested)
+	out, err := n.conf.readSamplesResponse(bufio.NewReader(stream), stream.SetReadDeadline, requestCount, func(dasSample *DASSample) error {
+		if err := n.checkRequestedSample(dasSample, slot, shard, requested); err != nil {
+			return err
+		}
+		// don't accept the same sample twice
+		delete(requested, dasSample.SampleIndex)
+		return nil
+	})
+	if err != nil {
+		_ = stream.Reset()
+		return nil, err
+	}
+	return out, nil
+}
+
+// readSamplesResponse reads the response chunks of a samples_by_index request, until the end of the stream.
+// Each decoded sample is checked with the given check, and at most requestCount samples are accepted.
+func (conf *ExpandedConfig) readSamplesResponse(r *bufio.Reader, setReadDeadline func(time.Time) error,
+	requestCount int, check func(dasSample *DASSample) error) ([]*DASSample, error) {
+	out := make([]*DASSample, 0, requestCount)
+	msgLength := conf.DASSampleLength()
+	for i := 0; ; i++ {
+		if i == 0 {
+			_ = setReadDeadline(time.Now().Add(TTFB_TIMEOUT))
+		} else {
+			_ = setReadDeadline(time.Now().Add(RESP_TIMEOUT))
+		}
+		code, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response code: %w", err)
+		}
+		if respCode(code) != respSuccess {
+			data, err := readSnappyChunk(r, maxErrorMessageLength)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read error response (code %d): %w", code, err)
+			}
+			return nil, fmt.Errorf("%w (code %d): %q", errSamplesResponseErr, code, string(data))
+		}
+		if len(out) >= requestCount {
+			return nil, fmt.Errorf("peer responded with more samples than requested")
+		}
+		data, err := readSnappyChunk(r, msgLength)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response chunk %d: %w", i, err)
+		}
+		dasSample, err := conf.DecodeDASSample(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode response chunk %d: %w", i, err)
+		}
+		if err := check(dasSample); err != nil {
+			return nil, fmt.Errorf("invalid response chunk %d: %w", i, err)
+		}
+		out = append(out, dasSample)
+	}
+	return out, nil
+}
+
+func (n *Eth2Node) checkRequestedSample(dasSample *DASSample, slot Slot, shard Shard, requested map[SampleIndex]struct{}) error {
+	if dasSample.Slot != slot || dasSample.Shard != shard {
+		return fmt.Errorf("sample of slot %d shard %d does not match requested slot %d shard %d", dasSample.Slot, dasSample.Shard, slot, shard)
+	}
+	if _, ok := requested[dasSample.SampleIndex]; !ok {
+		return fmt.Errorf("sample %d was not requested, or is a duplicate", dasSample.SampleIndex)
+	}
+	signedHeader := n.headers.get(dasSample.ShardHeaderRoot)
+	if signedHeader == nil {
+		return fmt.Errorf("unknown shard header %s", dasSample.ShardHeaderRoot)
+	}
+	header := &signedHeader.Message
+	if header.Slot != slot || header.Shard != shard {
+		return fmt.Errorf("shard header is for slot %d shard %d, not the requested shard block", header.Slot, header.Shard)
+	}
+	if err := n.kate.VerifySample(header, dasSample.SampleIndex, dasSample.Points, dasSample.Proof); err != nil {
+		return fmt.Errorf("bad sample proof: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package eth2node
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/protolambda/ztyp/codec"
+	"testing"
+	"time"
+)
+
+func TestSamplesByIndexRequestChunk(t *testing.T) {
+	req := SamplesByIndexRequest{Slot: 123, Shard: 4, Indices: SampleIndexList{0, 7, 3}}
+	var enc bytes.Buffer
+	if err := req.Serialize(codec.NewEncodingWriter(&enc)); err != nil {
+		t.Fatal(err)
+	}
+	if uint64(enc.Len()) != req.ByteLength() {
+		t.Fatalf("encoded %d bytes, expected %d", enc.Len(), req.ByteLength())
+	}
+	var stream bytes.Buffer
+	if err := writeSnappyChunk(&stream, enc.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	// a second chunk, to check the first read does not consume it
+	if err := writeSnappyChunk(&stream, []byte("next")); err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(&stream)
+	data, err := readSnappyChunk(r, maxSamplesByIndexRequestLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got SamplesByIndexRequest
+	if err := got.Deserialize(codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data)))); err != nil {
+		t.Fatal(err)
+	}
+	if got.Slot != req.Slot || got.Shard != req.Shard || len(got.Indices) != len(req.Indices) {
+		t.Fatalf("decoded request does not match: %v", got)
+	}
+	for i := range req.Indices {
+		if got.Indices[i] != req.Indices[i] {
+			t.Fatalf("index %d does not match: %d <> %d", i, got.Indices[i], req.Indices[i])
+		}
+	}
+	next, err := readSnappyChunk(r, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(next) != "next" {
+		t.Fatalf("unexpected second chunk: %q", next)
+	}
+
+	// chunks over the limit are not decompressed
+	stream.Reset()
+	if err := writeSnappyChunk(&stream, make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readSnappyChunk(bufio.NewReader(&stream), 99); err == nil {
+		t.Fatal("expected chunk over limit to fail")
+	}
+}
+
+func TestReadSamplesResponse(t *testing.T) {
+	conf := (&Config{POINTS_PER_SAMPLE: 4}).Expand()
+	noDeadline := func(time.Time) error { return nil }
+	writeSamples := func(indices ...SampleIndex) *bufio.Reader {
+		var stream bytes.Buffer
+		for _, i := range indices {
+			sample := conf.newDASSample()
+			sample.Slot = 10
+			sample.SampleIndex = i
+			var buf bytes.Buffer
+			if err := sample.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+				t.Fatal(err)
+			}
+			if err := writeResponseChunk(&stream, respSuccess, buf.Bytes()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return bufio.NewReader(&stream)
+	}
+	// accepts each requested index once, like RequestSamples
+	checkRequested := func(indices ...SampleIndex) func(*DASSample) error {
+		requested := make(map[SampleIndex]struct{})
+		for _, i := range indices {
+			requested[i] = struct{}{}
+		}
+		return func(dasSample *DASSample) error {
+			if _, ok := requested[dasSample.SampleIndex]; !ok {
+				return fmt.Errorf("unexpected sample %d", dasSample.SampleIndex)
+			}
+			delete(requested, dasSample.SampleIndex)
+			return nil
+		}
+	}
+
+	// all requested samples are returned
+	out, err := conf.readSamplesResponse(writeSamples(3, 1, 7, 5), noDeadline, 4, checkRequested(1, 3, 5, 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 4 {
+		t.Fatalf("expected 4 samples, got %d", len(out))
+	}
+	for i, expected := range []SampleIndex{3, 1, 7, 5} {
+		if out[i].SampleIndex != expected || out[i].Slot != 10 {
+			t.Fatalf("unexpected sample %d: %d", i, out[i].SampleIndex)
+		}
+	}
+	// a subset is fine too
+	out, err = conf.readSamplesResponse(writeSamples(1), noDeadline, 2, checkRequested(1, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 {
+		t.Fatalf("expected 1 sample, got %d", len(out))
+	}
+	// more samples than requested
+	if _, err := conf.readSamplesResponse(writeSamples(1, 3, 5), noDeadline, 2, func(*DASSample) error { return nil }); err == nil {
+		t.Fatal("expected error for too many samples")
+	}
+	// duplicates
+	if _, err := conf.readSamplesResponse(writeSamples(1, 1), noDeadline, 2, checkRequested(1, 3)); err == nil {
+		t.Fatal("expected error for duplicate sample")
+	}
+}
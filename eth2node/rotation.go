@@ -41,6 +41,7 @@ func (n *Eth2Node) rotateSlowVertSubnets(slot Slot) {
 			delete(n.fastIndices, subnet)
 			// just get the regular subnet info, strip out the rotation that was part of the FAST_INDICES subnets logic.
 			n.slowIndices[subnet] = &v.subnetInfo
+			n.recordSlowSwitch(slot, subnet)
 			continue
 		}
 		// and sometimes we really do have to open a new subscription
@@ -53,11 +54,48 @@ func (n *Eth2Node) rotateSlowVertSubnets(slot Slot) {
 				subscribedAt: slot,
 				sub:          sub,
 			}
+			n.recordSlowSwitch(slot, subnet)
 			go n.vertHandleSubnet(subnet, sub)
 		}
 	}
 }
 
+// SlowSwitchStats counts the switches to new SLOW_INDICES subnets, and how well peered the subnets were at the switch.
+type SlowSwitchStats struct {
+	Switches uint64
+	// Switches with less than TARGET_PEERS_PER_DAS_SUB mesh peers
+	UnderPeered uint64
+	// Number of gossipsub mesh peers of the topic at the switch -> number of switches.
+	MeshPeers map[uint64]uint64
+}
+
+// recordSlowSwitch records how many mesh peers the topic of a new SLOW_INDICES subnet had at the moment of the switch.
+// Gossipsub grafts the mesh when joining the topic, so the mesh is up to date right after subscribing.
+func (n *Eth2Node) recordSlowSwitch(slot Slot, subnet VerticalIndex) {
+	meshPeers := n.mesh.size(n.conf.VertTopic(subnet))
+	n.slowSwitchStatsLock.Lock()
+	defer n.slowSwitchStatsLock.Unlock()
+	n.slowSwitchStats.Switches += 1
+	if meshPeers < n.conf.TARGET_PEERS_PER_DAS_SUB {
+		n.slowSwitchStats.UnderPeered += 1
+		n.log.With("slot", slot, "subnet", subnet, "mesh_peers", meshPeers).Debug("switched to under-peered SLOW_INDICES subnet")
+	}
+	n.slowSwitchStats.MeshPeers[meshPeers] += 1
+}
+
+// SlowSwitchStats returns the counts of the switches to new SLOW_INDICES subnets so far,
+// including the initial subscriptions.
+func (n *Eth2Node) SlowSwitchStats() SlowSwitchStats {
+	n.slowSwitchStatsLock.Lock()
+	defer n.slowSwitchStatsLock.Unlock()
+	out := n.slowSwitchStats
+	out.MeshPeers = make(map[uint64]uint64, len(n.slowSwitchStats.MeshPeers))
+	for k, v := range n.slowSwitchStats.MeshPeers {
+		out.MeshPeers[k] = v
+	}
+	return out
+}
+
 // rotateFastVertSubnets, like rotateSlowVertSubnets, rotates subnets and does so robustly.
 // But instead of deterministically and publicly predictable subscribing, it is based on private local randomness.
 // Subscriptions in FAST_INDICES won't overlap with those in SLOW_INDICES, to avoid double work.
@@ -139,3 +177,25 @@ func (n *Eth2Node) rotateFastVertSubnets(slot Slot) {
 		info.sub.Cancel()
 	}
 }
+
+// updateOwnIndices snapshots the current SLOW_INDICES and FAST_INDICES subnets, after rotating them.
+func (n *Eth2Node) updateOwnIndices() {
+	own := make(map[VerticalIndex]Slot, len(n.slowIndices)+len(n.fastIndices))
+	for subnet, info := range n.slowIndices {
+		own[subnet] = info.subscribedAt
+	}
+	for subnet, info := range n.fastIndices {
+		own[subnet] = info.subscribedAt
+	}
+	n.ownIndicesLock.Lock()
+	n.ownIndices = own
+	n.ownIndicesLock.Unlock()
+}
+
+// getOwnIndices returns the current SLOW_INDICES and FAST_INDICES subnets, and the slot they were subscribed at.
+// The returned map must not be modified.
+func (n *Eth2Node) getOwnIndices() map[VerticalIndex]Slot {
+	n.ownIndicesLock.RLock()
+	defer n.ownIndicesLock.RUnlock()
+	return n.ownIndices
+}
@@ -0,0 +1,211 @@
+package eth2node
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	pubsub_pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"github.com/protolambda/ztyp/codec"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// RepublishPolicy determines which samples a node publishes to vertical subnets,
+// after receiving a shard block on a horizontal subnet.
+type RepublishPolicy uint8
+
+const (
+	// Only publish the samples of our current SLOW_INDICES and FAST_INDICES subnets
+	RepublishOwnIndices RepublishPolicy = iota
+	// Publish all samples
+	RepublishAll
+	// Split the samples between the members of the shard committee, deterministically.
+	// Each sample is published by the committee members that are assigned to it.
+	RepublishCommitteeSplit
+)
+
+// msgIDCache remembers which messages were published, to not publish duplicates.
+type msgIDCache struct {
+	sync.Mutex
+	ids map[string]Slot
+}
+
+// add returns false if the message ID was already known
+func (c *msgIDCache) add(id string, slot Slot) bool {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.ids[id]; ok {
+		return false
+	}
+	c.ids[id] = slot
+	return true
+}
+
+// prune forgets about messages older than the given slot
+func (c *msgIDCache) prune(minSlot Slot) {
+	c.Lock()
+	defer c.Unlock()
+	for id, slot := range c.ids {
+		if slot < minSlot {
+			delete(c.ids, id)
+		}
+	}
+}
+
+// makeDASSamples chunks the extended points into samples, and wraps each with its proof.
+func (n *Eth2Node) makeDASSamples(slot Slot, shard Shard, headerRoot Root, points []Point, proofs []KateProof) ([]*DASSample, error) {
+	samples, err := n.conf.pointsToSamples(points)
+	if err != nil {
+		return nil, err
+	}
+	if len(samples) != len(proofs) {
+		return nil, fmt.Errorf("got %d samples, but %d proofs", len(samples), len(proofs))
+	}
+	out := make([]*DASSample, len(samples), len(samples))
+	for i, sample := range samples {
+		out[i] = &DASSample{
+			Slot:            slot,
+			Shard:           shard,
+			SampleIndex:     SampleIndex(i),
+			ShardHeaderRoot: headerRoot,
+			Points:          sample,
+			Proof:           proofs[i],
+		}
+	}
+	return out, nil
+}
+
+// publishSamples publishes each of the DAS samples that pass the filter to its vertical subnet, see SampleSubnet.
+// Samples that were published before, or that were already seen on the subnet, are skipped.
+// The samples are published in parallel, and publishSamples returns when all publishing is done,
+// with the number of samples that were published, and the number that failed to publish, e.g. because of a timeout.
+func (n *Eth2Node) publishSamples(ctx context.Context, msgs []*DASSample, filter func(msg *DASSample) bool) (published uint64, failed uint64) {
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	for _, msg := range msgs {
+		if !filter(msg) {
+			continue
+		}
+		if n.seenSamples.has(sampleSeenKey{headerRoot: msg.ShardHeaderRoot, index: msg.SampleIndex}) {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := msg.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+			n.log.With(zap.Error(err)).Error("failed to encode sample for vert net")
+			continue
+		}
+		data := encodeGossip(buf.Bytes())
+		if !n.publishedSamples.add(MsgIDFunction(&pubsub_pb.Message{Data: data}), msg.Slot) {
+			continue
+		}
+		subnet := n.conf.SampleSubnet(msg.Slot, msg.Shard, msg.SampleIndex)
+		wg.Add(1)
+		go func(subnet VerticalIndex, data []byte) { // TODO: high parallelism here, maybe too much, might need to change it
+			defer wg.Done()
+			err := n.verticalSubnets[subnet].Publish(ctx, data)
+			lock.Lock()
+			if err != nil {
+				failed += 1
+			} else {
+				published += 1
+			}
+			lock.Unlock()
+			if err != nil {
+				n.log.With(zap.Error(err)).Error("failed to publish to vert net")
+			}
+		}(subnet, data)
+	}
+	wg.Wait()
+	return published, failed
+}
+
+// republishFilter selects the samples of a shard block to publish, based on the configured RepublishPolicy.
+func (n *Eth2Node) republishFilter(slot Slot, shard Shard) func(msg *DASSample) bool {
+	switch n.conf.REPUBLISH_POLICY {
+	case RepublishAll:
+		return func(msg *DASSample) bool {
+			return true
+		}
+	case RepublishCommitteeSplit:
+		committees, err := n.shardCommitteesAt(slot)
+		if err != nil {
+			n.log.With(zap.Error(err)).Error("failed to get shard committee, not republishing")
+			return func(msg *DASSample) bool {
+				return false
+			}
+		}
+		committee := committees.shard2Vals[shard]
+		committeeSize := uint64(len(committee))
+		sampleCount := n.conf.MAX_SAMPLES_PER_SHARD_BLOCK
+		// positions of the local validators in the committee
+		var positions []uint64
+		n.validatorsLock.RLock()
+		for i, val := range committee {
+			if _, ok := n.localValidators[val]; ok {
+				positions = append(positions, uint64(i))
+			}
+		}
+		n.validatorsLock.RUnlock()
+		return func(msg *DASSample) bool {
+			i := uint64(msg.SampleIndex)
+			for _, pos := range positions {
+				// Small committee: each member covers multiple samples.
+				// Large committee: each sample is covered by multiple members.
+				if pos == i%committeeSize || pos%sampleCount == i {
+					return true
+				}
+			}
+			return false
+		}
+	default:
+		own := n.getOwnIndices()
+		return func(msg *DASSample) bool {
+			_, ok := own[n.conf.SampleSubnet(msg.Slot, msg.Shard, msg.SampleIndex)]
+			return ok
+		}
+	}
+}
+
+// republishBlockSamples chunks the extended points of a validated shard block into samples,
+// and proves and publishes only the samples selected by the RepublishPolicy.
+func (n *Eth2Node) republishBlockSamples(slot Slot, shard Shard, headerRoot Root, points []Point) error {
+	samples, err := n.conf.pointsToSamples(points)
+	if err != nil {
+		return fmt.Errorf("failed to make samples: %v", err)
+	}
+	filter := n.republishFilter(slot, shard)
+	var msgs []*DASSample
+	var indices []SampleIndex
+	for i, sample := range samples {
+		msg := &DASSample{
+			Slot:            slot,
+			Shard:           shard,
+			SampleIndex:     SampleIndex(i),
+			ShardHeaderRoot: headerRoot,
+			Points:          sample,
+		}
+		if !filter(msg) || n.seenSamples.has(sampleSeenKey{headerRoot: headerRoot, index: msg.SampleIndex}) {
+			continue
+		}
+		msgs = append(msgs, msg)
+		indices = append(indices, msg.SampleIndex)
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	proofs, err := n.kate.ProveSampleIndices(points, indices)
+	if err != nil {
+		return fmt.Errorf("failed to prove samples: %v", err)
+	}
+	for i, msg := range msgs {
+		msg.Proof = proofs[i]
+	}
+	slotDuration := time.Second * time.Duration(n.conf.SECONDS_PER_SLOT)
+	ctx, cancel := context.WithTimeout(n.subProcesses.ctx, slotDuration)
+	defer cancel()
+	n.publishSamples(ctx, msgs, func(msg *DASSample) bool {
+		return true
+	})
+	return nil
+}
@@ -0,0 +1,202 @@
+package eth2node
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// SampleKey identifies a sample of a shard block
+type SampleKey struct {
+	Slot  Slot
+	Shard Shard
+	Index SampleIndex
+}
+
+var ErrSampleNotFound = errors.New("sample not found")
+
+// SampleStore buffers recently seen samples, to serve them on request.
+// Samples are stored as encoded DAS samples, so they can be served without any pre-processing.
+type SampleStore interface {
+	// Put stores the sample, replacing any previous sample with the same key.
+	Put(key SampleKey, data []byte) error
+	// Get returns ErrSampleNotFound if the sample is not stored.
+	Get(key SampleKey) ([]byte, error)
+	// Prune removes all samples older than the given slot.
+	Prune(minSlot Slot) error
+	Close() error
+}
+
+type sampleSlotKey struct {
+	shard Shard
+	index SampleIndex
+}
+
+type memorySampleSlot struct {
+	slot    Slot
+	samples map[sampleSlotKey][]byte
+}
+
+// MemorySampleStore keeps samples in a ring buffer of slots.
+// A sample overwrites the samples of the slot that was retention slots earlier.
+type MemorySampleStore struct {
+	sync.RWMutex
+	slots []memorySampleSlot
+}
+
+var _ SampleStore = (*MemorySampleStore)(nil)
+
+func NewMemorySampleStore(retentionSlots uint64) *MemorySampleStore {
+	if retentionSlots == 0 {
+		retentionSlots = 1
+	}
+	return &MemorySampleStore{slots: make([]memorySampleSlot, retentionSlots, retentionSlots)}
+}
+
+func (m *MemorySampleStore) Put(key SampleKey, data []byte) error {
+	m.Lock()
+	defer m.Unlock()
+	entry := &m.slots[uint64(key.Slot)%uint64(len(m.slots))]
+	if entry.samples == nil || entry.slot < key.Slot {
+		entry.slot = key.Slot
+		entry.samples = make(map[sampleSlotKey][]byte)
+	} else if entry.slot > key.Slot {
+		return fmt.Errorf("sample of slot %d is older than the retention period", key.Slot)
+	}
+	entry.samples[sampleSlotKey{shard: key.Shard, index: key.Index}] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *MemorySampleStore) Get(key SampleKey) ([]byte, error) {
+	m.RLock()
+	defer m.RUnlock()
+	entry := &m.slots[uint64(key.Slot)%uint64(len(m.slots))]
+	if entry.samples == nil || entry.slot != key.Slot {
+		return nil, ErrSampleNotFound
+	}
+	data, ok := entry.samples[sampleSlotKey{shard: key.Shard, index: key.Index}]
+	if !ok {
+		return nil, ErrSampleNotFound
+	}
+	return data, nil
+}
+
+func (m *MemorySampleStore) Prune(minSlot Slot) error {
+	m.Lock()
+	defer m.Unlock()
+	for i := range m.slots {
+		if m.slots[i].slot < minSlot {
+			m.slots[i] = memorySampleSlot{}
+		}
+	}
+	return nil
+}
+
+func (m *MemorySampleStore) Close() error {
+	return nil
+}
+
+// DiskSampleStore keeps samples as files in a directory, one sub-directory per slot.
+type DiskSampleStore struct {
+	dir string
+}
+
+var _ SampleStore = (*DiskSampleStore)(nil)
+
+func NewDiskSampleStore(dir string) (*DiskSampleStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create sample store dir: %w", err)
+	}
+	return &DiskSampleStore{dir: dir}, nil
+}
+
+func (d *DiskSampleStore) slotDir(slot Slot) string {
+	return filepath.Join(d.dir, strconv.FormatUint(uint64(slot), 10))
+}
+
+func (d *DiskSampleStore) samplePath(key SampleKey) string {
+	return filepath.Join(d.slotDir(key.Slot), fmt.Sprintf("%d_%d.ssz", key.Shard, key.Index))
+}
+
+func (d *DiskSampleStore) Put(key SampleKey, data []byte) error {
+	if err := os.MkdirAll(d.slotDir(key.Slot), 0755); err != nil {
+		return fmt.Errorf("failed to create slot dir: %w", err)
+	}
+	// write to a temporary file first, so readers never see a partially written sample
+	tmp, err := ioutil.TempFile(d.slotDir(key.Slot), "tmp_")
+	if err != nil {
+		return fmt.Errorf("failed to create sample file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write sample: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write sample: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), d.samplePath(key)); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to store sample: %w", err)
+	}
+	return nil
+}
+
+func (d *DiskSampleStore) Get(key SampleKey) ([]byte, error) {
+	data, err := ioutil.ReadFile(d.samplePath(key))
+	if os.IsNotExist(err) {
+		return nil, ErrSampleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sample: %w", err)
+	}
+	return data, nil
+}
+
+func (d *DiskSampleStore) Prune(minSlot Slot) error {
+	entries, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return fmt.Errorf("failed to list sample store dir: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		slot, err := strconv.ParseUint(entry.Name(), 10, 64)
+		if err != nil {
+			continue // not a slot dir
+		}
+		if Slot(slot) < minSlot {
+			if err := os.RemoveAll(filepath.Join(d.dir, entry.Name())); err != nil {
+				return fmt.Errorf("failed to prune slot %d: %w", slot, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (d *DiskSampleStore) Close() error {
+	return nil
+}
+
+// NewSampleStore creates a disk store if SAMPLE_STORE_DIR is configured, and a memory store otherwise.
+func (conf *ExpandedConfig) NewSampleStore() (SampleStore, error) {
+	if conf.SAMPLE_STORE_DIR != "" {
+		return NewDiskSampleStore(conf.SAMPLE_STORE_DIR)
+	}
+	return NewMemorySampleStore(conf.SAMPLE_STORE_RETENTION_SLOTS), nil
+}
+
+// storeSample buffers a validated sample, to serve it to peers later.
+func (n *Eth2Node) storeSample(dasSample *DASSample, data []byte) {
+	key := SampleKey{Slot: dasSample.Slot, Shard: dasSample.Shard, Index: dasSample.SampleIndex}
+	if err := n.samples.Put(key, data); err != nil {
+		n.log.With("slot", key.Slot, "shard", key.Shard, "index", key.Index, zap.Error(err)).Warn("failed to store sample")
+	}
+}
@@ -0,0 +1,65 @@
+package eth2node
+
+import (
+	"bytes"
+	"testing"
+)
+
+func testSampleStore(t *testing.T, store SampleStore) {
+	a := SampleKey{Slot: 10, Shard: 2, Index: 3}
+	b := SampleKey{Slot: 12, Shard: 0, Index: 3}
+	if _, err := store.Get(a); err != ErrSampleNotFound {
+		t.Fatalf("expected missing sample, got %v", err)
+	}
+	if err := store.Put(a, []byte("sample a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(b, []byte("sample b")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := store.Get(a); err != nil || !bytes.Equal(data, []byte("sample a")) {
+		t.Fatalf("unexpected sample a: %x, err: %v", data, err)
+	}
+	if _, err := store.Get(SampleKey{Slot: 10, Shard: 2, Index: 4}); err != ErrSampleNotFound {
+		t.Fatalf("expected missing sample, got %v", err)
+	}
+	if err := store.Prune(11); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(a); err != ErrSampleNotFound {
+		t.Fatalf("expected pruned sample, got %v", err)
+	}
+	if data, err := store.Get(b); err != nil || !bytes.Equal(data, []byte("sample b")) {
+		t.Fatalf("unexpected sample b: %x, err: %v", data, err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemorySampleStore(t *testing.T) {
+	testSampleStore(t, NewMemorySampleStore(8))
+
+	// samples of older slots are overwritten, once the ring buffer wraps around
+	store := NewMemorySampleStore(4)
+	if err := store.Put(SampleKey{Slot: 1}, []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(SampleKey{Slot: 5}, []byte{5}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(SampleKey{Slot: 1}); err != ErrSampleNotFound {
+		t.Fatalf("expected overwritten sample, got %v", err)
+	}
+	if err := store.Put(SampleKey{Slot: 1}, []byte{1}); err == nil {
+		t.Fatal("expected error for sample older than retention period")
+	}
+}
+
+func TestDiskSampleStore(t *testing.T) {
+	store, err := NewDiskSampleStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSampleStore(t, store)
+}
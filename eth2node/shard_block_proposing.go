@@ -9,6 +9,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/protolambda/zrnt/eth2/beacon"
 	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
 	"go.uber.org/zap"
 	"io"
 	"math/rand"
@@ -16,7 +17,11 @@ import (
 )
 
 func (n *Eth2Node) scheduleShardProposalsMaybe(slot Slot) {
-	proposers := n.computeShardProposers(slot)
+	proposers, err := n.computeShardProposers(slot)
+	if err != nil {
+		n.log.With(zap.Error(err)).With("slot", slot).Error("failed to compute shard proposers")
+		return
+	}
 	for shard, proposer := range proposers {
 		if _, ok := n.localValidators[proposer]; ok {
 			n.log.With("proposer", proposer, "slot", slot, "shard", shard).Info("proposing shard block")
@@ -30,25 +35,43 @@ func (n *Eth2Node) scheduleShardProposalsMaybe(slot Slot) {
 }
 
 // proposers, 1 per shard, for all shards
-func (n *Eth2Node) computeShardProposers(slot Slot) []ValidatorIndex {
+func (n *Eth2Node) computeShardProposers(slot Slot) ([]ValidatorIndex, error) {
+	epochSeed, err := n.beaconView.Seed(n.conf.SlotToEpoch(slot))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get seed for proposers of slot %d: %v", slot, err)
+	}
+	committees, err := n.shardCommitteesAt(slot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get committees for proposers of slot %d: %v", slot, err)
+	}
 	out := make([]ValidatorIndex, n.conf.SHARD_COUNT, n.conf.SHARD_COUNT)
 	h := sha256.New()
 	for shard := Shard(0); shard < Shard(n.conf.SHARD_COUNT); shard++ {
-		// Mock seed, since there's no beacon chain. Just decide on a proposer by using the time and shard as seed.
+		// Like the beacon proposer: mix the epoch seed with the slot, and the shard.
 		h.Reset()
+		h.Write(epochSeed[:])
 		binary.Write(h, binary.LittleEndian, uint64(slot))
 		binary.Write(h, binary.LittleEndian, uint64(shard))
 		var seed beacon.Root
 		copy(seed[:], h.Sum(nil))
 		// Take the committee, shuffle lookup for 0, to get any random committee member as proposer.
 		// Not the actual proposer logic, but good enough for testing
-		committeee := n.shard2Vals[shard]
+		committeee := committees.shard2Vals[shard]
 		proposerCommIndex := beacon.PermuteIndex(n.conf.SHUFFLE_ROUND_COUNT, 0, uint64(len(committeee)), seed)
 		proposer := committeee[proposerCommIndex]
 
 		out[shard] = proposer
 	}
-	return out
+	return out, nil
+}
+
+// beaconParentRoot is the root of the beacon block that a shard block of the given slot builds on:
+// the beacon block of the previous slot, or the first beacon block for slot 0.
+func (n *Eth2Node) beaconParentRoot(slot Slot) (Root, error) {
+	if slot > 0 {
+		slot -= 1
+	}
+	return n.beaconView.BlockRoot(slot)
 }
 
 func (n *Eth2Node) executeShardBlockProposal(slot Slot, shard Shard, proposer ValidatorIndex) error {
@@ -60,27 +83,46 @@ func (n *Eth2Node) executeShardBlockProposal(slot Slot, shard Shard, proposer Va
 	if _, err := io.ReadFull(rng, data); err != nil {
 		panic(fmt.Errorf("failed to create random mock data: %v", err))
 	}
+	points, err := n.conf.shardDataToPoints(data)
+	if err != nil {
+		return errors.Wrap(err, "proposer failed to convert data to points")
+	}
+	commitment, proofs, err := n.kate.ProveSamples(points)
+	if err != nil {
+		return errors.Wrap(err, "proposer failed to commit to data")
+	}
+	beaconParent, err := n.beaconParentRoot(slot)
+	if err != nil {
+		return errors.Wrap(err, "proposer failed to get beacon parent root")
+	}
+	// build on the head of the shard chain
+	shardParent, _ := n.shardChains.head(shard)
 	block := SignedShardBlock{
 		Message: ShardBlock{
-			ShardParentRoot:  Root{}, // TODO
-			BeaconParentRoot: Root{}, // TODO
+			ShardParentRoot:  shardParent,
+			BeaconParentRoot: beaconParent,
 			Slot:             slot,
 			Shard:            shard,
 			ProposerIndex:    proposer,
 			Body:             ShardBlockData(data),
 		},
-		Signature: BLSSignature{}, // TODO
 	}
 	header := SignedShardBlockHeader{
 		Message: ShardBlockHeader{
-			ShardParentRoot:  Root{}, // TODO
-			BeaconParentRoot: Root{}, // TODO
+			ShardParentRoot:  shardParent,
+			BeaconParentRoot: beaconParent,
 			Slot:             slot,
 			Shard:            shard,
 			ProposerIndex:    proposer,
-			BodyRoot:         Root{}, // TODO
+			BodyRoot:         block.Message.Body.HashTreeRoot(tree.GetHashFn()),
+			BodyCommitment:   commitment,
 		},
-		Signature: BLSSignature{}, // TODO
+	}
+	if block.Signature, err = n.signProposal(proposer, block.Message.HashTreeRoot(tree.GetHashFn())); err != nil {
+		return errors.Wrap(err, "proposer failed to sign block")
+	}
+	if header.Signature, err = n.signProposal(proposer, header.Message.HashTreeRoot(tree.GetHashFn())); err != nil {
+		return errors.Wrap(err, "proposer failed to sign header")
 	}
 
 	// try publishing everything for the extension of 2/3 of a slot. Give up afterwards.
@@ -92,7 +134,7 @@ func (n *Eth2Node) executeShardBlockProposal(slot Slot, shard Shard, proposer Va
 		if err := header.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
 			return errors.Wrap(err, "proposer failed to encode header")
 		}
-		if err := n.shardHeaders.Publish(ctx, buf.Bytes()); err != nil {
+		if err := n.shardHeaders.Publish(ctx, encodeGossip(buf.Bytes())); err != nil {
 			return errors.Wrap(err, "proposer failed to publish header")
 		}
 	}
@@ -103,34 +145,23 @@ func (n *Eth2Node) executeShardBlockProposal(slot Slot, shard Shard, proposer Va
 		if err := block.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
 			return errors.Wrap(err, "proposer failed to encode block")
 		}
-		if err := n.horizontalSubnets[shard].Publish(ctx, buf.Bytes()); err != nil {
+		if err := n.horizontalSubnets[shard].Publish(ctx, encodeGossip(buf.Bytes())); err != nil {
 			return errors.Wrap(err, "proposer failed to publish block to horizontal net")
 		}
 	}
 
 	// Publish samples to vertical nets
 	{
-		samples, err := n.conf.MakeSamples(block.Message.Body)
+		msgs, err := n.makeDASSamples(slot, shard, header.Message.HashTreeRoot(tree.GetHashFn()), points, proofs)
 		if err != nil {
 			return errors.Wrap(err, "proposer failed to make samples")
 		}
 		// TODO: how long should the node try to spend on getting a publishing round done before skipping?
 		ctx, _ := context.WithTimeout(n.subProcesses.ctx, 2*time.Second*time.Duration(n.conf.SECONDS_PER_SLOT))
-
-		for i, sample := range samples {
-			go func(i int, sample ShardBlockDataChunk) { // TODO: high parallelism here, maybe too much, might need to change it
-				var buf bytes.Buffer
-				if err := sample.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
-					n.log.With(zap.Error(err)).Error("failed to encode sample for vert net")
-					return
-				}
-				err := n.verticalSubnets[i].Publish(ctx, buf.Bytes())
-				if err != nil {
-					n.log.With(zap.Error(err)).Error("failed to publish to vert net")
-					return
-				}
-			}(i, sample)
-		}
+		// the proposer publishes all samples
+		n.publishSamples(ctx, msgs, func(msg *DASSample) bool {
+			return true
+		})
 	}
 	return nil
 }
@@ -0,0 +1,160 @@
+package eth2node
+
+import (
+	"bytes"
+	"sync"
+)
+
+// shardChainBlock is a shard block in the block tree of its shard, identified by the root of its header.
+type shardChainBlock struct {
+	slot       Slot
+	parentRoot Root
+	// true if the shard block itself was received on the horizontal subnet, not just the header
+	hasBlock bool
+	verdict  AvailabilityVerdict
+	// true if the parent was pruned: the block is connected to the tree as far as we know.
+	anchored bool
+}
+
+// shardChain is the block tree of a single shard.
+// Blocks link to their parent with the ShardParentRoot: the header root of the parent shard block.
+// The zero root is the parent of the first shard block.
+type shardChain struct {
+	blocks map[Root]*shardChainBlock
+}
+
+// viable returns true if the block and all its ancestors are known, and not unavailable.
+// Results are memoized in the given map, to not walk the same ancestors again.
+func (c *shardChain) viable(root Root, memo map[Root]bool) bool {
+	if root == (Root{}) {
+		return true
+	}
+	if v, ok := memo[root]; ok {
+		return v
+	}
+	block, ok := c.blocks[root]
+	v := false
+	if ok && block.verdict != AvailabilityUnavailable {
+		v = block.anchored || c.viable(block.parentRoot, memo)
+	}
+	memo[root] = v
+	return v
+}
+
+// head is the fork choice of the shard: the block with the latest slot, of the blocks that are viable.
+// When there are multiple, blocks with an available verdict are preferred over undetermined blocks,
+// then blocks of which the body was received over blocks of which only the header is known,
+// and the lowest root breaks any remaining tie. If no block is viable, the zero root is returned.
+func (c *shardChain) head() (root Root, slot Slot) {
+	memo := make(map[Root]bool)
+	var best *shardChainBlock
+	for r, block := range c.blocks {
+		if !c.viable(r, memo) {
+			continue
+		}
+		if best != nil {
+			if block.slot < best.slot {
+				continue
+			}
+			if block.slot == best.slot {
+				if block.verdict != best.verdict {
+					if block.verdict != AvailabilityAvailable {
+						continue
+					}
+				} else if block.hasBlock != best.hasBlock {
+					if !block.hasBlock {
+						continue
+					}
+				} else if bytes.Compare(r[:], root[:]) > 0 {
+					continue
+				}
+			}
+		}
+		best = block
+		root = r
+	}
+	if best == nil {
+		return Root{}, 0
+	}
+	return root, best.slot
+}
+
+// shardChains tracks the block tree of every shard
+type shardChains struct {
+	sync.Mutex
+	chains []*shardChain
+}
+
+func newShardChains(shardCount uint64) *shardChains {
+	chains := make([]*shardChain, shardCount, shardCount)
+	for i := range chains {
+		chains[i] = &shardChain{blocks: make(map[Root]*shardChainBlock)}
+	}
+	return &shardChains{chains: chains}
+}
+
+func (s *shardChains) getOrAdd(root Root, header *ShardBlockHeader) *shardChainBlock {
+	chain := s.chains[header.Shard]
+	block, ok := chain.blocks[root]
+	if !ok {
+		block = &shardChainBlock{slot: header.Slot, parentRoot: header.ShardParentRoot}
+		chain.blocks[root] = block
+	}
+	return block
+}
+
+// addHeader adds an accepted shard header to the tree of its shard
+func (s *shardChains) addHeader(root Root, header *ShardBlockHeader) {
+	s.Lock()
+	defer s.Unlock()
+	s.getOrAdd(root, header)
+}
+
+// addBlock marks the shard block of an accepted header as received
+func (s *shardChains) addBlock(root Root, header *ShardBlockHeader) {
+	s.Lock()
+	defer s.Unlock()
+	s.getOrAdd(root, header).hasBlock = true
+}
+
+// setVerdict updates the availability verdict of a shard block, this may change the head of the shard.
+func (s *shardChains) setVerdict(shard Shard, root Root, verdict AvailabilityVerdict) {
+	s.Lock()
+	defer s.Unlock()
+	if block, ok := s.chains[shard].blocks[root]; ok {
+		block.verdict = verdict
+	}
+}
+
+func (s *shardChains) head(shard Shard) (Root, Slot) {
+	s.Lock()
+	defer s.Unlock()
+	return s.chains[shard].head()
+}
+
+// prune forgets about blocks older than the given slot. The children of pruned blocks are anchored.
+func (s *shardChains) prune(minSlot Slot) {
+	s.Lock()
+	defer s.Unlock()
+	for _, chain := range s.chains {
+		for _, block := range chain.blocks {
+			if parent, ok := chain.blocks[block.parentRoot]; ok && parent.slot < minSlot {
+				block.anchored = true
+			}
+		}
+		for root, block := range chain.blocks {
+			if block.slot < minSlot {
+				delete(chain.blocks, root)
+			}
+		}
+	}
+}
+
+// ShardHead returns the header root and slot of the head of the shard chain, according to the local fork choice.
+// The zero root is returned if there is no shard block yet.
+func (n *Eth2Node) ShardHead(shard Shard) (root Root, slot Slot) {
+	if uint64(shard) >= n.conf.SHARD_COUNT {
+		return Root{}, 0
+	}
+	return n.shardChains.head(shard)
+}
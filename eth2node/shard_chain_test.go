@@ -0,0 +1,46 @@
+package eth2node
+
+import "testing"
+
+func TestShardChainHead(t *testing.T) {
+	chains := newShardChains(2)
+	add := func(root Root, parent Root, slot Slot) {
+		chains.addHeader(root, &ShardBlockHeader{Slot: slot, Shard: 1, ShardParentRoot: parent})
+	}
+	expectHead := func(expected Root) {
+		t.Helper()
+		if head, _ := chains.head(1); head != expected {
+			t.Fatalf("expected head %x, got %x", expected[:1], head[:1])
+		}
+	}
+	expectHead(Root{})
+
+	a, b, c, d := Root{0xa}, Root{0xb}, Root{0xc}, Root{0xd}
+	add(a, Root{}, 1)
+	add(b, a, 2)
+	expectHead(b)
+	// a fork at the same slot, with a lower root: a received body is preferred over only a header
+	z := Root{0x1}
+	add(z, a, 2)
+	expectHead(z)
+	chains.addBlock(b, &ShardBlockHeader{Slot: 2, Shard: 1, ShardParentRoot: a})
+	expectHead(b)
+	// available is preferred over undetermined, even without the body
+	add(c, a, 2)
+	chains.setVerdict(1, c, AvailabilityAvailable)
+	expectHead(c)
+	// unavailable blocks, and their descendants, are not viable
+	add(d, c, 3)
+	expectHead(d)
+	chains.setVerdict(1, c, AvailabilityUnavailable)
+	expectHead(b)
+	// orphans are not viable
+	add(Root{0xe}, Root{0xff}, 4)
+	expectHead(b)
+	// after pruning the parent, the child is anchored
+	chains.prune(2)
+	expectHead(b)
+	if head, _ := chains.head(0); head != (Root{}) {
+		t.Fatal("expected other shard to be unaffected")
+	}
+}
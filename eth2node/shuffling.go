@@ -1,38 +1,90 @@
 package eth2node
 
 import (
-	"crypto/sha256"
-	"encoding/binary"
+	"fmt"
 	"github.com/protolambda/zrnt/eth2/beacon"
+	"sync"
 )
 
-// shardCommitteeShuffling computes mock shard committee assignments for each shard.
-func (n *Eth2Node) shardCommitteeShuffling(seedNum uint64) (shard2Vals [][]ValidatorIndex, val2Shard []Shard) {
-	// Don't use beacon chain, just do randomness based on slot, something simple
-	h := sha256.New()
-	binary.Write(h, binary.LittleEndian, seedNum)
-	var seed beacon.Root
-	copy(seed[:], h.Sum(nil))
-
-	// init array with all indices. Everyone is active in this experiment
-	out := make([]ValidatorIndex, n.conf.VALIDATOR_COUNT, n.conf.VALIDATOR_COUNT)
-	for i := ValidatorIndex(0); i < ValidatorIndex(len(out)); i++ {
-		out[i] = i
+// shardCommittees are the shard committees of a committee period
+type shardCommittees struct {
+	// shard -> committee
+	shard2Vals [][]ValidatorIndex
+	// shard of each active validator
+	val2Shard map[ValidatorIndex]Shard
+}
+
+// committeeCache keeps the shard committees of recent and upcoming committee periods
+type committeeCache struct {
+	sync.Mutex
+	periods map[uint64]*shardCommittees
+}
+
+// prune forgets about the committees of periods before the given period
+func (c *committeeCache) prune(minPeriod uint64) {
+	c.Lock()
+	defer c.Unlock()
+	for period := range c.periods {
+		if period < minPeriod {
+			delete(c.periods, period)
+		}
+	}
+}
+
+// shardCommitteesAt returns the shard committees of the committee period of the slot.
+// Like phase 1, the committees are shuffled with the seed of the start of the previous period,
+// so the committees are known a full period ahead.
+func (n *Eth2Node) shardCommitteesAt(slot Slot) (*shardCommittees, error) {
+	period := n.conf.CommitteePeriod(slot)
+	c := &n.committees
+	c.Lock()
+	defer c.Unlock()
+	if committees, ok := c.periods[period]; ok {
+		return committees, nil
 	}
+	sourceEpoch := Epoch(0)
+	if period > 0 {
+		sourceEpoch = Epoch((period - 1) * n.conf.SHARD_COMMITTEE_PERIOD)
+	}
+	shard2Vals, val2Shard, err := n.shardCommitteeShuffling(sourceEpoch)
+	if err != nil {
+		return nil, err
+	}
+	committees := &shardCommittees{shard2Vals: shard2Vals, val2Shard: val2Shard}
+	c.periods[period] = committees
+	return committees, nil
+}
+
+// shardCommitteeShuffling computes the shard committee assignments of the epoch for each shard,
+// by shuffling the active validators with the seed of the epoch.
+func (n *Eth2Node) shardCommitteeShuffling(epoch Epoch) (shard2Vals [][]ValidatorIndex, val2Shard map[ValidatorIndex]Shard, err error) {
+	seed, err := n.beaconView.Seed(epoch)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get seed of epoch %d: %v", epoch, err)
+	}
+	active, err := n.beaconView.ActiveValidators(epoch)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get active validators of epoch %d: %v", epoch, err)
+	}
+
+	// copy, the shuffle is in-place
+	out := make([]ValidatorIndex, len(active), len(active))
+	copy(out, active)
 
 	// shuffle in-place
 	beacon.ShuffleList(n.conf.SHUFFLE_ROUND_COUNT, out, seed)
 
+	count := uint64(len(out))
 	shard2Vals = make([][]ValidatorIndex, n.conf.SHARD_COUNT, n.conf.SHARD_COUNT)
-	val2Shard = make([]Shard, n.conf.VALIDATOR_COUNT, n.conf.VALIDATOR_COUNT)
+	val2Shard = make(map[ValidatorIndex]Shard, count)
 	// keep this simple, just split between all shards. No inactive shards or double work.
 	for i := uint64(0); i < n.conf.SHARD_COUNT; i++ {
-		start := n.conf.VALIDATOR_COUNT * i / n.conf.SHARD_COUNT
-		end := n.conf.VALIDATOR_COUNT * (i + 1) / n.conf.SHARD_COUNT
+		start := count * i / n.conf.SHARD_COUNT
+		end := count * (i + 1) / n.conf.SHARD_COUNT
 		shard2Vals[i] = out[start:end]
 		for _, val := range out[start:end] {
 			val2Shard[val] = Shard(i)
 		}
 	}
-	return shard2Vals, val2Shard
+	return shard2Vals, val2Shard, nil
 }
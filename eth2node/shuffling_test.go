@@ -0,0 +1,78 @@
+package eth2node
+
+import "testing"
+
+func TestShardCommitteeShuffling(t *testing.T) {
+	n := &Eth2Node{
+		conf:       (&Config{SHARD_COUNT: 4, SHUFFLE_ROUND_COUNT: 10}).Expand(),
+		beaconView: &MockBeaconView{ValidatorCount: 100},
+	}
+	shard2Vals, val2Shard, err := n.shardCommitteeShuffling(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(val2Shard) != 100 {
+		t.Fatalf("expected all 100 validators in a committee, got %d", len(val2Shard))
+	}
+	for shard, committee := range shard2Vals {
+		if len(committee) != 25 {
+			t.Fatalf("shard %d has committee of size %d, expected 25", shard, len(committee))
+		}
+		for _, val := range committee {
+			if val2Shard[val] != Shard(shard) {
+				t.Fatalf("validator %d in committee of shard %d, but mapped to shard %d", val, shard, val2Shard[val])
+			}
+		}
+	}
+	// different seed, different committees
+	_, otherVal2Shard, err := n.shardCommitteeShuffling(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved := 0
+	for val, shard := range val2Shard {
+		if otherVal2Shard[val] != shard {
+			moved++
+		}
+	}
+	if moved == 0 {
+		t.Fatal("expected committees to change between epochs")
+	}
+}
+
+func TestShardCommitteePeriods(t *testing.T) {
+	n := &Eth2Node{
+		conf:       (&Config{SHARD_COUNT: 4, SHUFFLE_ROUND_COUNT: 10, SLOTS_PER_EPOCH: 4, SHARD_COMMITTEE_PERIOD: 2}).Expand(),
+		beaconView: &MockBeaconView{ValidatorCount: 100},
+		committees: committeeCache{periods: make(map[uint64]*shardCommittees)},
+	}
+	at := func(slot Slot) *shardCommittees {
+		committees, err := n.shardCommitteesAt(slot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return committees
+	}
+	same := func(a, b *shardCommittees) bool {
+		for val, shard := range a.val2Shard {
+			if b.val2Shard[val] != shard {
+				return false
+			}
+		}
+		return true
+	}
+	if at(0) != at(7) {
+		t.Fatal("expected the same committees within a period")
+	}
+	// the first two periods both use the seed of epoch 0
+	if !same(at(7), at(8)) {
+		t.Fatal("expected the committees of period 1 to be shuffled with the seed of epoch 0")
+	}
+	if same(at(15), at(16)) {
+		t.Fatal("expected new committees at the start of period 2")
+	}
+	n.committees.prune(2)
+	if len(n.committees.periods) != 1 {
+		t.Fatalf("expected only period 2 after pruning, got %d periods", len(n.committees.periods))
+	}
+}
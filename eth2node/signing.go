@@ -0,0 +1,104 @@
+package eth2node
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	hbls "github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/protolambda/ztyp/tree"
+	"sync"
+)
+
+// Like phase 1: the domain type of shard block proposals.
+var DOMAIN_SHARD_PROPOSER = [4]byte{0x80, 0x00, 0x00, 0x00}
+
+// ShardProposerDomain is the signature domain of shard block proposals: the domain type, followed by the fork digest.
+// There is no beacon state to compute the fork-data-root from, the fork digest is the first 4 bytes of it.
+func (c *Config) ShardProposerDomain() Root {
+	var domain Root
+	copy(domain[0:4], DOMAIN_SHARD_PROPOSER[:])
+	copy(domain[4:8], c.ForkDigest[:])
+	return domain
+}
+
+// computeSigningRoot is the hash-tree-root of the SigningData container of the object root and domain, like phase 0.
+func computeSigningRoot(objectRoot Root, domain Root) Root {
+	return tree.GetHashFn().HashTreeRoot(&objectRoot, &domain)
+}
+
+// InteropSecretKey returns the deterministic interop secret key of the validator, like the phase 0 interop keys:
+// the little-endian integer of the sha256 of the 32 byte little-endian validator index, modulo the curve order.
+func InteropSecretKey(index ValidatorIndex) (*hbls.SecretKey, error) {
+	var buf [32]byte
+	binary.LittleEndian.PutUint64(buf[:8], uint64(index))
+	h := sha256.Sum256(buf[:])
+	var sk hbls.SecretKey
+	if err := sk.SetLittleEndianMod(h[:]); err != nil {
+		return nil, fmt.Errorf("failed to create interop key of validator %d: %v", index, err)
+	}
+	return &sk, nil
+}
+
+// The interop pubkeys are derived once, and shared between the nodes of the process.
+var interopPubkeys = struct {
+	sync.RWMutex
+	keys map[ValidatorIndex]*hbls.PublicKey
+}{keys: make(map[ValidatorIndex]*hbls.PublicKey)}
+
+// InteropPubkey returns the interop public key of the validator.
+func InteropPubkey(index ValidatorIndex) (*hbls.PublicKey, error) {
+	interopPubkeys.RLock()
+	pub, ok := interopPubkeys.keys[index]
+	interopPubkeys.RUnlock()
+	if ok {
+		return pub, nil
+	}
+	sk, err := InteropSecretKey(index)
+	if err != nil {
+		return nil, err
+	}
+	pub = sk.GetPublicKey()
+	interopPubkeys.Lock()
+	interopPubkeys.keys[index] = pub
+	interopPubkeys.Unlock()
+	return pub, nil
+}
+
+// signProposal signs the root of a shard block or header, with the interop key of the proposer.
+func (n *Eth2Node) signProposal(proposer ValidatorIndex, objectRoot Root) (BLSSignature, error) {
+	sk, err := InteropSecretKey(proposer)
+	if err != nil {
+		return BLSSignature{}, err
+	}
+	signingRoot := computeSigningRoot(objectRoot, n.conf.ShardProposerDomain())
+	var out BLSSignature
+	copy(out[:], sk.SignByte(signingRoot[:]).Serialize())
+	return out, nil
+}
+
+var errBadSignature = errors.New("invalid signature")
+
+// verifyProposal verifies the signature of the proposer over the root of a shard block or header.
+// Verification is skipped if DISABLE_SIGNATURE_VERIFICATION is set.
+func (n *Eth2Node) verifyProposal(proposer ValidatorIndex, objectRoot Root, signature BLSSignature) error {
+	if n.conf.DISABLE_SIGNATURE_VERIFICATION {
+		return nil
+	}
+	if uint64(proposer) >= n.conf.VALIDATOR_COUNT {
+		return fmt.Errorf("unknown validator %d", proposer)
+	}
+	pub, err := InteropPubkey(proposer)
+	if err != nil {
+		return err
+	}
+	var sig hbls.Sign
+	if err := sig.Deserialize(signature[:]); err != nil {
+		return fmt.Errorf("failed to decode signature: %v", err)
+	}
+	signingRoot := computeSigningRoot(objectRoot, n.conf.ShardProposerDomain())
+	if !sig.VerifyByte(pub, signingRoot[:]) {
+		return errBadSignature
+	}
+	return nil
+}
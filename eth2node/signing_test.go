@@ -0,0 +1,29 @@
+package eth2node
+
+import "testing"
+
+func TestProposalSignature(t *testing.T) {
+	n := &Eth2Node{conf: (&Config{VALIDATOR_COUNT: 10, ForkDigest: [4]byte{1, 2, 3, 4}}).Expand()}
+	root := Root{0xaa}
+	sig, err := n.signProposal(3, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.verifyProposal(3, root, sig); err != nil {
+		t.Fatalf("expected valid signature: %v", err)
+	}
+	if err := n.verifyProposal(4, root, sig); err == nil {
+		t.Fatal("expected signature of other validator to be invalid")
+	}
+	if err := n.verifyProposal(3, Root{0xbb}, sig); err == nil {
+		t.Fatal("expected signature of other root to be invalid")
+	}
+	other := &Eth2Node{conf: (&Config{VALIDATOR_COUNT: 10, ForkDigest: [4]byte{5, 6, 7, 8}}).Expand()}
+	if err := other.verifyProposal(3, root, sig); err == nil {
+		t.Fatal("expected signature of other fork to be invalid")
+	}
+	other.conf.DISABLE_SIGNATURE_VERIFICATION = true
+	if err := other.verifyProposal(3, root, sig); err != nil {
+		t.Fatalf("expected verification to be skipped: %v", err)
+	}
+}
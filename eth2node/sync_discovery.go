@@ -0,0 +1,255 @@
+package eth2node
+
+import (
+	"context"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"sync"
+)
+
+// DiscRecord is the discovery info of a node, as shared with all other nodes through a sync service.
+// Only plain types are used, for the JSON encoding of the Testground sync service.
+type DiscRecord struct {
+	ID    string   `json:"id"`
+	Addrs []string `json:"addrs"`
+	// The SLOW_INDICES count of the node
+	SlowIndices uint64   `json:"slow_indices"`
+	Validators  []uint64 `json:"validators"`
+}
+
+// NewDiscRecord creates the discovery record of a node, with the SLOW_INDICES count of the node.
+func NewDiscRecord(id peer.ID, addrs []ma.Multiaddr, slowIndices uint64, validators []ValidatorIndex) *DiscRecord {
+	rec := &DiscRecord{ID: peer.Encode(id), SlowIndices: slowIndices}
+	for _, addr := range addrs {
+		rec.Addrs = append(rec.Addrs, addr.String())
+	}
+	for _, val := range validators {
+		rec.Validators = append(rec.Validators, uint64(val))
+	}
+	return rec
+}
+
+// SyncService shares the discovery records between all nodes of a test run, like the Testground sync service.
+type SyncService interface {
+	// PublishRecord publishes the record of a node to all nodes.
+	PublishRecord(ctx context.Context, rec *DiscRecord) error
+	// SubscribeRecords returns all records, including those published before subscribing.
+	// The channel is closed when the context is done.
+	SubscribeRecords(ctx context.Context) (<-chan *DiscRecord, error)
+	// SignalAndWait signals the given state, and waits for the target number of nodes to signal the same state.
+	SignalAndWait(ctx context.Context, state string, target int) error
+}
+
+type syncPeer struct {
+	addrs       []ma.Multiaddr
+	slowIndices uint64
+	validators  []ValidatorIndex
+}
+
+// SyncDiscovery is a Discovery that learns about all nodes of the test run through a SyncService.
+type SyncDiscovery struct {
+	sync.RWMutex
+	service SyncService
+	peers   map[peer.ID]*syncPeer
+	// the public subnets of the peers
+	index BackboneIndex
+	// closed and replaced whenever a peer is added
+	notify chan struct{}
+}
+
+func NewSyncDiscovery(service SyncService) *SyncDiscovery {
+	return &SyncDiscovery{
+		service: service,
+		peers:   make(map[peer.ID]*syncPeer),
+		notify:  make(chan struct{}),
+	}
+}
+
+// State signaled by each node after publishing its record
+const syncDiscoveryState = "disc_published"
+
+// Join publishes the record of the local node, and keeps track of the records of all other nodes until ctx is done.
+// Join blocks until all nodes published their record, and the records of all nodes are known:
+// call it after starting the node, and before genesis.
+func (d *SyncDiscovery) Join(ctx context.Context, rec *DiscRecord, nodeCount int) error {
+	records, err := d.service.SubscribeRecords(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to discovery records: %w", err)
+	}
+	go d.handleRecords(records)
+	if err := d.service.PublishRecord(ctx, rec); err != nil {
+		return fmt.Errorf("failed to publish discovery record: %w", err)
+	}
+	if err := d.service.SignalAndWait(ctx, syncDiscoveryState, nodeCount); err != nil {
+		return fmt.Errorf("failed to wait for other nodes to publish their record: %w", err)
+	}
+	for {
+		d.RLock()
+		count := len(d.peers)
+		notify := d.notify
+		d.RUnlock()
+		if count >= nodeCount {
+			return nil
+		}
+		select {
+		case <-notify:
+			continue
+		case <-ctx.Done():
+			return fmt.Errorf("only received %d out of %d discovery records: %w", count, nodeCount, ctx.Err())
+		}
+	}
+}
+
+func (d *SyncDiscovery) handleRecords(records <-chan *DiscRecord) {
+	for rec := range records {
+		id, err := peer.Decode(rec.ID)
+		if err != nil {
+			continue
+		}
+		p := &syncPeer{slowIndices: rec.SlowIndices}
+		for _, addr := range rec.Addrs {
+			if a, err := ma.NewMultiaddr(addr); err == nil {
+				p.addrs = append(p.addrs, a)
+			}
+		}
+		for _, val := range rec.Validators {
+			p.validators = append(p.validators, ValidatorIndex(val))
+		}
+		d.index.AddPeer(id, p.slowIndices)
+		d.Lock()
+		d.peers[id] = p
+		close(d.notify)
+		d.notify = make(chan struct{})
+		d.Unlock()
+	}
+}
+
+func (d *SyncDiscovery) FindPublic(conf *ExpandedConfig, slot Slot, subnets map[VerticalIndex]struct{}) map[VerticalIndex][]peer.ID {
+	return d.index.Find(conf, slot, subnets)
+}
+
+func (d *SyncDiscovery) PrefetchPublic(conf *ExpandedConfig, slot Slot) {
+	d.index.Prefetch(conf, slot)
+}
+
+func (d *SyncDiscovery) SlowIndices(id peer.ID) (count uint64, ok bool) {
+	d.RLock()
+	defer d.RUnlock()
+	if p, ok := d.peers[id]; ok {
+		return p.slowIndices, true
+	}
+	return 0, false
+}
+
+func (d *SyncDiscovery) FindCommitteePeers(committee []ValidatorIndex) []peer.ID {
+	members := make(map[ValidatorIndex]struct{}, len(committee))
+	for _, val := range committee {
+		members[val] = struct{}{}
+	}
+	d.RLock()
+	defer d.RUnlock()
+	var out []peer.ID
+	for id, p := range d.peers {
+		for _, val := range p.validators {
+			if _, ok := members[val]; ok {
+				out = append(out, id)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// Get addrs of a peer, may be nil if the peer is unknown.
+func (d *SyncDiscovery) Addrs(id peer.ID) []ma.Multiaddr {
+	d.RLock()
+	defer d.RUnlock()
+	if p, ok := d.peers[id]; ok {
+		return p.addrs
+	}
+	return nil
+}
+
+// MemorySyncService is an in-process stand-in for the Testground sync service,
+// shared by all the nodes of a test, to run tests offline.
+type MemorySyncService struct {
+	sync.Mutex
+	records []*DiscRecord
+	states  map[string]int
+	// closed and replaced whenever a record is published or a state is signaled
+	notify chan struct{}
+}
+
+func NewMemorySyncService() *MemorySyncService {
+	return &MemorySyncService{
+		states: make(map[string]int),
+		notify: make(chan struct{}),
+	}
+}
+
+func (m *MemorySyncService) changed() {
+	close(m.notify)
+	m.notify = make(chan struct{})
+}
+
+func (m *MemorySyncService) PublishRecord(ctx context.Context, rec *DiscRecord) error {
+	m.Lock()
+	defer m.Unlock()
+	m.records = append(m.records, rec)
+	m.changed()
+	return nil
+}
+
+func (m *MemorySyncService) SubscribeRecords(ctx context.Context) (<-chan *DiscRecord, error) {
+	out := make(chan *DiscRecord)
+	go func() {
+		defer close(out)
+		for i := 0; ; {
+			m.Lock()
+			notify := m.notify
+			var next *DiscRecord
+			if i < len(m.records) {
+				next = m.records[i]
+			}
+			m.Unlock()
+			if next == nil {
+				select {
+				case <-notify:
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case out <- next:
+				i++
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (m *MemorySyncService) SignalAndWait(ctx context.Context, state string, target int) error {
+	m.Lock()
+	m.states[state] += 1
+	m.changed()
+	m.Unlock()
+	for {
+		m.Lock()
+		count := m.states[state]
+		notify := m.notify
+		m.Unlock()
+		if count >= target {
+			return nil
+		}
+		select {
+		case <-notify:
+			continue
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
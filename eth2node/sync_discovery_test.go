@@ -0,0 +1,77 @@
+package eth2node
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"testing"
+	"time"
+)
+
+func TestSyncDiscovery(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	service := NewMemorySyncService()
+	nodeCount := 3
+	ids := make([]peer.ID, nodeCount)
+	discs := make([]*SyncDiscovery, nodeCount)
+	errs := make(chan error, nodeCount)
+	conf := &Config{SLOW_INDICES: 1, MAX_SAMPLES_PER_SHARD_BLOCK: 4, SHARD_COUNT: 4, SLOTS_PER_SLOW_ROTATION: 8}
+	expConf := conf.Expand()
+	slowCounts := []uint64{1, 2, expConf.SAMPLE_SUBNETS}
+	for i := 0; i < nodeCount; i++ {
+		priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i], err = peer.IDFromPrivateKey(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		discs[i] = NewSyncDiscovery(service)
+		addr := ma.StringCast(fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", 9000+i))
+		// the last node is a super-node, with as many SLOW_INDICES as there are subnets
+		rec := NewDiscRecord(ids[i], []ma.Multiaddr{addr}, slowCounts[i], []ValidatorIndex{ValidatorIndex(i)})
+		go func(d *SyncDiscovery) {
+			errs <- d.Join(ctx, rec, nodeCount)
+		}(discs[i])
+	}
+	for i := 0; i < nodeCount; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, d := range discs {
+		for i, id := range ids {
+			addrs := d.Addrs(id)
+			if len(addrs) != 1 || addrs[0].String() != fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", 9000+i) {
+				t.Fatalf("unexpected addrs of node %d: %v", i, addrs)
+			}
+		}
+		for i, id := range ids {
+			if count, ok := d.SlowIndices(id); !ok || count != slowCounts[i] {
+				t.Fatalf("unexpected slow indices count of node %d: %d", i, count)
+			}
+		}
+		// FindPublic must use the advertised count of each peer
+		subnets := map[VerticalIndex]struct{}{0: {}, 1: {}}
+		backbone := d.FindPublic(&expConf, 0, subnets)
+		for subnet := range subnets {
+			expected := 0
+			for i, id := range ids {
+				if _, ok := expConf.DasSlowSubnetIndices(id, 0, slowCounts[i])[subnet]; ok {
+					expected++
+				}
+			}
+			if len(backbone[subnet]) != expected {
+				t.Fatalf("expected %d backbone peers on subnet %d, got %v", expected, subnet, backbone[subnet])
+			}
+		}
+		if found := d.FindCommitteePeers([]ValidatorIndex{1}); len(found) != 1 || found[0] != ids[1] {
+			t.Fatalf("expected to find node 1 as committee peer, got %v", found)
+		}
+	}
+}
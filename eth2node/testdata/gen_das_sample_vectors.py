@@ -0,0 +1,76 @@
+"""
+Generates SSZ test vectors for the DASSample container, independent of the Go implementation.
+
+    class DASSample(Container):
+        slot: Slot
+        shard: Shard
+        sample_index: SampleIndex
+        shard_header_root: Root
+        points: Vector[Bytes32, POINTS_PER_SAMPLE]
+        proof: Bytes48
+
+Usage: python3 gen_das_sample_vectors.py > das_sample_vectors.json
+"""
+import hashlib
+import json
+
+
+def h(a: bytes, b: bytes) -> bytes:
+    return hashlib.sha256(a + b).digest()
+
+
+def merkleize(chunks):
+    size = 1
+    while size < len(chunks):
+        size *= 2
+    layer = list(chunks) + [b"\x00" * 32] * (size - len(chunks))
+    while len(layer) > 1:
+        layer = [h(layer[i], layer[i + 1]) for i in range(0, len(layer), 2)]
+    return layer[0]
+
+
+def pack(data: bytes):
+    data += b"\x00" * ((-len(data)) % 32)
+    return [data[i:i + 32] for i in range(0, len(data), 32)]
+
+
+def uint64(v: int) -> bytes:
+    return v.to_bytes(8, "little")
+
+
+def das_sample_vector(name, points_per_sample, slot, shard, sample_index, seed):
+    root = hashlib.sha256(b"header" + seed).digest()
+    points = b"".join(hashlib.sha256(seed + uint64(i)).digest() for i in range(points_per_sample))
+    proof = (hashlib.sha256(b"proof" + seed).digest() * 2)[:48]
+    serialized = uint64(slot) + uint64(shard) + uint64(sample_index) + root + points + proof
+    htr = merkleize([
+        pack(uint64(slot))[0],
+        pack(uint64(shard))[0],
+        pack(uint64(sample_index))[0],
+        root,
+        merkleize(pack(points)),
+        merkleize(pack(proof)),
+    ])
+    return {
+        "name": name,
+        "points_per_sample": points_per_sample,
+        "slot": slot,
+        "shard": shard,
+        "sample_index": sample_index,
+        "shard_header_root": "0x" + root.hex(),
+        "points": "0x" + points.hex(),
+        "proof": "0x" + proof.hex(),
+        "serialized": "0x" + serialized.hex(),
+        "root": "0x" + htr.hex(),
+    }
+
+
+vectors = [
+    das_sample_vector("zero_index", 16, 0, 0, 0, b"a"),
+    das_sample_vector("mid_slot", 16, 123456, 17, 9, b"b"),
+    das_sample_vector("max_values", 16, 2**64 - 1, 2**64 - 1, 2**64 - 1, b"c"),
+    das_sample_vector("small_sample", 4, 42, 3, 2, b"d"),
+    das_sample_vector("single_point", 1, 7, 1, 31, b"e"),
+]
+
+print(json.dumps(vectors, indent=2))
@@ -1,21 +1,72 @@
 package eth2node
 
 import (
+	"bytes"
 	"context"
 	"github.com/libp2p/go-libp2p-core/peer"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
 	"go.uber.org/zap"
+	"time"
 )
 
 func (n *Eth2Node) shardHeaderValidator() pubsub.ValidatorEx {
 	return func(ctx context.Context, p peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
-		// TODO header validation
-		return pubsub.ValidationAccept
+		stats := n.headerValidationStats
+		data, err := decodeGossip(msg.Data, (&SignedShardBlockHeader{}).FixedLength())
+		if err != nil {
+			return stats.reject("snappy")
+		}
+		var signedHeader SignedShardBlockHeader
+		if err := signedHeader.Deserialize(codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data)))); err != nil {
+			return stats.reject("decode")
+		}
+		header := &signedHeader.Message
+		lo, hi := n.conf.currentSlotRange(time.Now())
+		// headers are published ahead of the slot
+		if header.Slot > hi+1 {
+			return stats.ignore("future_slot")
+		}
+		if header.Slot < lo {
+			return stats.ignore("old_slot")
+		}
+		if uint64(header.Shard) >= n.conf.SHARD_COUNT {
+			return stats.reject("bad_shard")
+		}
+		proposers, err := n.computeShardProposers(header.Slot)
+		if err != nil {
+			return stats.ignore("unknown_proposers")
+		}
+		if proposers[header.Shard] != header.ProposerIndex {
+			return stats.reject("wrong_proposer")
+		}
+		// the beacon view may be behind or on a different beacon fork, this is not the fault of the proposer.
+		if beaconParent, err := n.beaconParentRoot(header.Slot); err != nil || beaconParent != header.BeaconParentRoot {
+			return stats.ignore("unknown_beacon_parent")
+		}
+		root := header.HashTreeRoot(tree.GetHashFn())
+		if err := n.verifyProposal(header.ProposerIndex, root, signedHeader.Signature); err != nil {
+			return stats.reject("bad_signature")
+		}
+		switch n.headers.add(root, &signedHeader) {
+		case headerDuplicate:
+			return stats.ignore("duplicate")
+		case headerEquivocation:
+			n.log.With("slot", header.Slot, "shard", header.Shard, "proposer", header.ProposerIndex,
+				"root", root, "from", p).Warn("proposer equivocation, ignoring second shard header")
+			return stats.ignore("equivocation")
+		case headerCacheFull:
+			return stats.ignore("cache_full")
+		}
+		n.availability.addHeader(root, header)
+		n.shardChains.addHeader(root, header)
+		return stats.accept()
 	}
 }
 
 func (n *Eth2Node) shardHeaderHandler(sub *pubsub.Subscription) {
-	{
+	for {
 		msg, err := sub.Next(n.subProcesses.ctx)
 		if err != nil {
 			if err == n.subProcesses.ctx.Err() {
@@ -29,8 +80,24 @@ func (n *Eth2Node) shardHeaderHandler(sub *pubsub.Subscription) {
 			return
 		}
 		if msg.ReceivedFrom == n.h.ID() { // ignore our own messages
-			return
+			continue
+		}
+		n.sink.OnMessage(n.conf.ShardHeadersTopic(), msg)
+		data, err := decodeGossip(msg.Data, (&SignedShardBlockHeader{}).FixedLength())
+		if err != nil {
+			n.log.With(zap.Error(err)).Error("failed to decompress validated shard header")
+			continue
+		}
+		var signedHeader SignedShardBlockHeader
+		if err := signedHeader.Deserialize(codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data)))); err != nil {
+			n.log.With(zap.Error(err)).Error("failed to decode validated shard header")
+			continue
 		}
-		n.log.With("from", msg.ReceivedFrom, "length", len(msg.Data)).Debug("received header message")
+		header := &signedHeader.Message
+		root := header.HashTreeRoot(tree.GetHashFn())
+		n.log.With("from", msg.ReceivedFrom, "slot", header.Slot, "shard", header.Shard,
+			"proposer", header.ProposerIndex, "root", root).Debug("received header message")
+		// computing the points of a pending block is slow, do it in the background, to keep reading the topic
+		go n.processPendingBlock(root, header)
 	}
 }
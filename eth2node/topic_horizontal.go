@@ -1,43 +1,246 @@
 package eth2node
 
 import (
+	"bytes"
 	"context"
 	"github.com/libp2p/go-libp2p-core/peer"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
 	"go.uber.org/zap"
+	"sync"
+	"time"
 )
 
-func (n *Eth2Node) subscribeHorzSubnets() {
-	// no changing of committees implemented in prototype.
-	// Just used current committee shuffling in node state
+// updateHorzSubnets subscribes to the horizontal subnets of the shards that the local validators are in the committee of.
+// The subnets of the next committee period are joined HORZ_SUBNET_LOOKAHEAD_SLOTS before the period starts,
+// and the subnets of the previous period are left one slot after the period ended, to still process late shard blocks.
+// Peers for the joined subnets are searched for right away, to be ready when the committee period starts.
+func (n *Eth2Node) updateHorzSubnets(slot Slot) {
+	slots := []Slot{slot, slot + Slot(n.conf.HORZ_SUBNET_LOOKAHEAD_SLOTS)}
+	if slot > 0 {
+		slots = append(slots, slot-1)
+	}
+	// shard -> committee of the shard, for the latest period that the shard is validated in
+	want := make(map[Shard][]ValidatorIndex)
+	n.validatorsLock.RLock()
+	for _, s := range slots {
+		committees, err := n.shardCommitteesAt(s)
+		if err != nil {
+			n.log.With(zap.Error(err)).With("slot", s).Error("failed to get shard committees")
+			continue
+		}
+		for val := range n.localValidators {
+			shard, ok := committees.val2Shard[val]
+			if !ok { // not active
+				continue
+			}
+			if _, ok := want[shard]; !ok || s > slot {
+				want[shard] = committees.shard2Vals[shard]
+			}
+		}
+	}
+	n.validatorsLock.RUnlock()
 
-	// Find all shards the node is participating in
-	shards := make(map[Shard]struct{})
-	for val := range n.localValidators {
-		shard := n.val2Shard[val]
-		shards[shard] = struct{}{}
+	for shard, sub := range n.horizontalSubs {
+		if _, ok := want[shard]; !ok {
+			sub.Cancel()
+			delete(n.horizontalSubs, shard)
+			n.log.With("shard", shard, "slot", slot).Info("left horizontal subnet")
+		}
 	}
-	n.log.With("validating_shards", shards).Info("validating on shards")
-	for shard := range shards {
-		topic := n.horizontalSubnets[shard]
-		sub, err := topic.Subscribe()
+	for shard := range want {
+		if _, ok := n.horizontalSubs[shard]; ok {
+			continue
+		}
+		sub, err := n.horizontalSubnets[shard].Subscribe()
 		if err != nil {
-			n.log.With(zap.Error(err)).Error("failed to subscribe to shard")
+			n.log.With(zap.Error(err)).With("shard", shard).Error("failed to subscribe to shard")
+			continue
 		}
 		n.horizontalSubs[shard] = sub
-		go n.horzHandleSubnet(Shard(shard), sub)
+		go n.horzHandleSubnet(shard, sub)
+		n.log.With("shard", shard, "slot", slot).Info("joined horizontal subnet")
+	}
+	n.horzPeersUpdate(want)
+}
+
+// validatedShardBlock is the ValidatorData of accepted shard block messages:
+// the extended points of the body, matching the commitment of the header.
+type validatedShardBlock struct {
+	slot       Slot
+	shard      Shard
+	headerRoot Root
+	points     []Point
+}
+
+// pendingBlocksLimit is the max number of shard blocks to keep while waiting for their headers:
+// one for each shard of the previous, current and next slot (blocks may be published ahead of the slot).
+func pendingBlocksLimit(shardCount uint64) int {
+	return int(3 * shardCount)
+}
+
+// pendingBlocks keeps the valid shard blocks that arrived before their header, to process them when the header arrives.
+// Only the first block of each (slot, shard, proposer) is kept.
+type pendingBlocks struct {
+	sync.Mutex
+	blocks map[proposalKey]*ShardBlock
+	// max number of blocks kept at any time
+	limit int
+}
+
+func newPendingBlocks(limit int) *pendingBlocks {
+	return &pendingBlocks{blocks: make(map[proposalKey]*ShardBlock), limit: limit}
+}
+
+// add returns false if a block of the same proposal is already pending, or if there is no more space.
+func (p *pendingBlocks) add(block *ShardBlock) bool {
+	p.Lock()
+	defer p.Unlock()
+	key := proposalKey{slot: block.Slot, shard: block.Shard, proposer: block.ProposerIndex}
+	if _, ok := p.blocks[key]; ok {
+		return false
+	}
+	if len(p.blocks) >= p.limit {
+		return false
+	}
+	p.blocks[key] = block
+	return true
+}
+
+// take removes and returns the pending block of the proposal, or nil if there is none.
+func (p *pendingBlocks) take(slot Slot, shard Shard, proposer ValidatorIndex) *ShardBlock {
+	p.Lock()
+	defer p.Unlock()
+	key := proposalKey{slot: slot, shard: shard, proposer: proposer}
+	block, ok := p.blocks[key]
+	if !ok {
+		return nil
+	}
+	delete(p.blocks, key)
+	return block
+}
+
+// prune forgets about blocks older than the given slot
+func (p *pendingBlocks) prune(minSlot Slot) {
+	p.Lock()
+	defer p.Unlock()
+	for key := range p.blocks {
+		if key.slot < minSlot {
+			delete(p.blocks, key)
+		}
 	}
 }
 
 func (n *Eth2Node) horzSubnetValidator(shard Shard) pubsub.ValidatorEx {
 	return func(ctx context.Context, p peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
-		// TODO subnet validation
-		return pubsub.ValidationAccept
+		stats := n.horzValidationStats
+		data, err := decodeGossip(msg.Data, n.conf.SignedShardBlockMaxLength())
+		if err != nil {
+			return stats.reject("snappy")
+		}
+		var signedBlock SignedShardBlock
+		if err := signedBlock.Deserialize(codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data)))); err != nil {
+			return stats.reject("decode")
+		}
+		block := &signedBlock.Message
+		if block.Shard != shard {
+			return stats.reject("wrong_shard")
+		}
+		lo, hi := n.conf.currentSlotRange(time.Now())
+		// blocks are published ahead of the slot
+		if block.Slot > hi+1 {
+			return stats.ignore("future_slot")
+		}
+		if block.Slot < lo {
+			return stats.ignore("old_slot")
+		}
+		proposers, err := n.computeShardProposers(block.Slot)
+		if err != nil {
+			return stats.ignore("unknown_proposers")
+		}
+		if proposers[block.Shard] != block.ProposerIndex {
+			return stats.reject("wrong_proposer")
+		}
+		if uint64(len(block.Body)) > n.conf.MAX_DATA_SIZE {
+			return stats.reject("too_large")
+		}
+		if err := n.verifyProposal(block.ProposerIndex, block.HashTreeRoot(tree.GetHashFn()), signedBlock.Signature); err != nil {
+			return stats.reject("bad_signature")
+		}
+
+		headerRoot, signedHeader := n.headers.getByProposal(block.Slot, block.Shard, block.ProposerIndex)
+		if signedHeader == nil {
+			// The header may arrive a little later than the block: keep the block, to process it when the header arrives.
+			// The header may have arrived after the lookup and before the block was added, so look again.
+			if !n.pendingBlocks.add(block) {
+				return stats.ignore("unknown_header")
+			}
+			if headerRoot, signedHeader = n.headers.getByProposal(block.Slot, block.Shard, block.ProposerIndex); signedHeader == nil {
+				return stats.ignore("pending_header")
+			}
+			if n.pendingBlocks.take(block.Slot, block.Shard, block.ProposerIndex) == nil {
+				// already taken by the header handler
+				return stats.ignore("pending_header")
+			}
+		}
+		header := &signedHeader.Message
+		points, res := n.validateShardBlockBody(stats, header, block)
+		if res != pubsub.ValidationAccept {
+			return res
+		}
+		n.shardChains.addBlock(headerRoot, header)
+		// keep the work of the validator, to republish the samples without recomputing the points
+		msg.ValidatorData = &validatedShardBlock{slot: block.Slot, shard: block.Shard, headerRoot: headerRoot, points: points}
+		return res
+	}
+}
+
+// validateShardBlockBody checks the shard block against its header, and returns the extended points of the body.
+// The result is counted in the given stats.
+func (n *Eth2Node) validateShardBlockBody(stats *ValidationStats, header *ShardBlockHeader, block *ShardBlock) ([]Point, pubsub.ValidationResult) {
+	// The parents are ignored, not rejected: the proposer may have equivocated,
+	// and the peer may have seen the other header first.
+	if header.ShardParentRoot != block.ShardParentRoot || header.BeaconParentRoot != block.BeaconParentRoot {
+		return nil, stats.ignore("header_mismatch")
+	}
+	if header.BodyRoot != block.Body.HashTreeRoot(tree.GetHashFn()) {
+		return nil, stats.reject("body_root_mismatch")
+	}
+	points, err := n.conf.shardDataToPoints(block.Body)
+	if err != nil {
+		return nil, stats.reject("bad_body")
+	}
+	commitment, err := n.kate.Commit(points)
+	if err != nil {
+		return nil, stats.reject("bad_body")
+	}
+	if commitment != header.BodyCommitment {
+		return nil, stats.reject("commitment_mismatch")
+	}
+	return points, stats.accept()
+}
+
+// processPendingBlock processes the shard block that arrived before the given header, if any:
+// the block was ignored during validation, so the samples are republished here instead of by the subnet handler.
+func (n *Eth2Node) processPendingBlock(headerRoot Root, header *ShardBlockHeader) {
+	block := n.pendingBlocks.take(header.Slot, header.Shard, header.ProposerIndex)
+	if block == nil {
+		return
+	}
+	points, res := n.validateShardBlockBody(n.horzValidationStats, header, block)
+	if res != pubsub.ValidationAccept {
+		n.log.With("slot", block.Slot, "shard", block.Shard, "proposer", block.ProposerIndex).Warn("pending shard block does not match header")
+		return
+	}
+	n.shardChains.addBlock(headerRoot, header)
+	if err := n.republishBlockSamples(block.Slot, block.Shard, headerRoot, points); err != nil {
+		n.log.With(zap.Error(err), "shard", block.Shard, "slot", block.Slot).Warn("failed to republish samples of shard block")
 	}
 }
 
 func (n *Eth2Node) horzHandleSubnet(shard Shard, sub *pubsub.Subscription) {
-	{
+	for {
 		msg, err := sub.Next(n.subProcesses.ctx)
 		if err != nil {
 			if err == n.subProcesses.ctx.Err() {
@@ -51,14 +254,23 @@ func (n *Eth2Node) horzHandleSubnet(shard Shard, sub *pubsub.Subscription) {
 			return
 		}
 		if msg.ReceivedFrom == n.h.ID() { // ignore our own messages
-			return
+			continue
 		}
+		n.sink.OnMessage(n.conf.HorzTopic(shard), msg)
 		n.log.With("from", msg.ReceivedFrom, "shard", shard, "length", len(msg.Data)).Debug("received horz message")
 
-		// TODO
-		// Each node that receives the shard block on a shard subnet,
-		// divides it into CHUNK_SIZE chunks ordered from chunk 0 to chunk MAX_BLOCK_SIZE / CHUNK_SIZE.
-		// The node then takes the chunks corresponding to the node’s node_indices and broadcasts each on its particular subnet
-
+		// Each node that receives the shard block on a shard subnet, divides it into samples.
+		// The node then takes the samples selected by the republish policy, and broadcasts each on its vertical subnet.
+		// Proving the samples is slow, so it runs in the background, to keep reading the subnet.
+		block, ok := msg.ValidatorData.(*validatedShardBlock)
+		if !ok {
+			n.log.With("shard", shard).Error("validated shard block message without validator data")
+			continue
+		}
+		go func() {
+			if err := n.republishBlockSamples(block.slot, block.shard, block.headerRoot, block.points); err != nil {
+				n.log.With(zap.Error(err), "shard", block.shard, "slot", block.slot).Warn("failed to republish samples of shard block")
+			}
+		}()
 	}
 }
@@ -0,0 +1,107 @@
+package eth2node
+
+import (
+	"bytes"
+	"context"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pubsub_pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestHorzSubnetValidator(t *testing.T) {
+	conf := testPointsConfig()
+	conf.SECONDS_PER_SLOT = 12
+	conf.SLOTS_PER_EPOCH = 4
+	conf.SHARD_COMMITTEE_PERIOD = 2
+	conf.SHUFFLE_ROUND_COUNT = 10
+	conf.VALIDATOR_COUNT = 100
+	conf.GENESIS_TIME = uint64(time.Now().Unix())
+	n := &Eth2Node{
+		conf:                conf,
+		beaconView:          &MockBeaconView{ValidatorCount: conf.VALIDATOR_COUNT},
+		committees:          committeeCache{periods: make(map[uint64]*shardCommittees)},
+		headers:             newHeaderCache(headerCacheLimit(conf.SHARD_COUNT)),
+		pendingBlocks:       newPendingBlocks(pendingBlocksLimit(conf.SHARD_COUNT)),
+		shardChains:         newShardChains(conf.SHARD_COUNT),
+		horzValidationStats: newValidationStats(),
+	}
+	setup, err := conf.KateSetup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.kate, err = conf.NewKateSettings(setup); err != nil {
+		t.Fatal(err)
+	}
+	proposers, err := n.computeShardProposers(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rng := rand.New(rand.NewSource(123))
+	// small blocks are valid, like full blocks
+	for i, size := range []uint64{0, 100, conf.MAX_DATA_SIZE} {
+		shard := Shard(i)
+		data := make([]byte, size, size)
+		rng.Read(data)
+		points, err := conf.shardDataToPoints(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commitment, err := n.kate.Commit(points)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block := SignedShardBlock{Message: ShardBlock{Slot: 0, Shard: shard, ProposerIndex: proposers[shard], Body: data}}
+		if block.Signature, err = n.signProposal(block.Message.ProposerIndex, block.Message.HashTreeRoot(tree.GetHashFn())); err != nil {
+			t.Fatal(err)
+		}
+		header := SignedShardBlockHeader{Message: ShardBlockHeader{
+			Slot:           0,
+			Shard:          shard,
+			ProposerIndex:  proposers[shard],
+			BodyRoot:       block.Message.Body.HashTreeRoot(tree.GetHashFn()),
+			BodyCommitment: commitment,
+		}}
+
+		var buf bytes.Buffer
+		if err := block.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+			t.Fatal(err)
+		}
+		// without the header, the block is ignored, and kept until the header arrives
+		msg := &pubsub.Message{Message: &pubsub_pb.Message{Data: encodeGossip(buf.Bytes())}}
+		if res := n.horzSubnetValidator(shard)(context.Background(), "", msg); res != pubsub.ValidationIgnore {
+			t.Fatalf("size %d: expected block without header to be ignored, got %d", size, res)
+		}
+		if n.pendingBlocks.take(0, shard, proposers[shard]) == nil {
+			t.Fatalf("size %d: expected block to be pending", size)
+		}
+
+		n.headers.add(header.Message.HashTreeRoot(tree.GetHashFn()), &header)
+		msg = &pubsub.Message{Message: &pubsub_pb.Message{Data: encodeGossip(buf.Bytes())}}
+		if res := n.horzSubnetValidator(shard)(context.Background(), "", msg); res != pubsub.ValidationAccept {
+			t.Fatalf("size %d: expected block to be accepted, got %d, stats: %v", size, res, n.horzValidationStats.Snapshot())
+		}
+		// the points are kept, to republish the samples with
+		if validated, ok := msg.ValidatorData.(*validatedShardBlock); !ok {
+			t.Fatalf("size %d: expected validator data", size)
+		} else if validated.headerRoot != header.Message.HashTreeRoot(tree.GetHashFn()) || len(validated.points) != len(points) {
+			t.Fatalf("size %d: unexpected validator data", size)
+		}
+	}
+
+	// a body that does not match the header is rejected
+	block := SignedShardBlock{Message: ShardBlock{Slot: 0, Shard: 0, ProposerIndex: proposers[0], Body: []byte{1, 2, 3}}}
+	var buf bytes.Buffer
+	if err := block.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	n.conf.DISABLE_SIGNATURE_VERIFICATION = true
+	msg := &pubsub.Message{Message: &pubsub_pb.Message{Data: encodeGossip(buf.Bytes())}}
+	if res := n.horzSubnetValidator(0)(context.Background(), "", msg); res != pubsub.ValidationReject {
+		t.Fatalf("expected block with other body to be rejected, got %d", res)
+	}
+}
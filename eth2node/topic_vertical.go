@@ -5,17 +5,121 @@ import (
 	"github.com/libp2p/go-libp2p-core/peer"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"go.uber.org/zap"
+	"sync"
+	"time"
 )
 
-func (n *Eth2Node) vertSubnetValidator(index VerticalIndex) pubsub.ValidatorEx {
+type sampleSeenKey struct {
+	headerRoot Root
+	index      SampleIndex
+}
+
+// seenSamples tracks the first valid sample for each (header root, index), to ignore any duplicates.
+type seenSamples struct {
+	sync.Mutex
+	seen map[sampleSeenKey]Slot
+}
+
+func (s *seenSamples) has(key sampleSeenKey) bool {
+	s.Lock()
+	defer s.Unlock()
+	_, ok := s.seen[key]
+	return ok
+}
+
+// add returns false if the sample was already seen
+func (s *seenSamples) add(key sampleSeenKey, slot Slot) bool {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.seen[key]; ok {
+		return false
+	}
+	s.seen[key] = slot
+	return true
+}
+
+// prune forgets about samples older than the given slot
+func (s *seenSamples) prune(minSlot Slot) {
+	s.Lock()
+	defer s.Unlock()
+	for k, slot := range s.seen {
+		if slot < minSlot {
+			delete(s.seen, k)
+		}
+	}
+}
+
+// validatedSample is the ValidatorData of accepted DAS sample messages:
+// the decoded sample, and the header it was verified against.
+type validatedSample struct {
+	sample *DASSample
+	data   []byte
+	header *ShardBlockHeader
+}
+
+func (n *Eth2Node) vertSubnetValidator(subnet VerticalIndex) pubsub.ValidatorEx {
 	return func(ctx context.Context, p peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
-		// TODO subnet validation
-		return pubsub.ValidationAccept
+		stats := n.vertValidationStats
+		data, err := decodeGossip(msg.Data, n.conf.DASSampleLength())
+		if err != nil {
+			return stats.reject("snappy")
+		}
+		dasSample, err := n.conf.DecodeDASSample(data)
+		if err != nil {
+			return stats.reject("decode")
+		}
+		lo, hi := n.conf.currentSlotRange(time.Now())
+		// samples may be published ahead of the slot, together with the shard block
+		if dasSample.Slot > hi+1 {
+			return stats.ignore("future_slot")
+		}
+		if dasSample.Slot+SAMPLE_PROPAGATION_SLOT_RANGE < lo {
+			return stats.ignore("old_slot")
+		}
+		if uint64(dasSample.Shard) >= n.conf.SHARD_COUNT {
+			return stats.reject("bad_shard")
+		}
+		if uint64(dasSample.SampleIndex) >= n.conf.MAX_SAMPLES_PER_SHARD_BLOCK {
+			return stats.reject("bad_index")
+		}
+		if n.conf.SampleSubnet(dasSample.Slot, dasSample.Shard, dasSample.SampleIndex) != subnet {
+			return stats.reject("wrong_subnet")
+		}
+		for i := uint64(0); i < n.conf.POINTS_PER_SAMPLE; i++ {
+			if !IsCanonicalPoint(dasSample.Points[i*BYTES_PER_FULL_POINT : (i+1)*BYTES_PER_FULL_POINT]) {
+				return stats.reject("non_canonical_point")
+			}
+		}
+		key := sampleSeenKey{headerRoot: dasSample.ShardHeaderRoot, index: dasSample.SampleIndex}
+		if n.seenSamples.has(key) {
+			return stats.ignore("duplicate")
+		}
+		signedHeader := n.headers.get(dasSample.ShardHeaderRoot)
+		if signedHeader == nil {
+			// the header may still be on its way
+			return stats.ignore("unknown_header")
+		}
+		header := &signedHeader.Message
+		if header.Slot != dasSample.Slot {
+			return stats.reject("header_slot_mismatch")
+		}
+		if header.Shard != dasSample.Shard {
+			return stats.reject("header_shard_mismatch")
+		}
+		if err := n.kate.VerifySample(header, dasSample.SampleIndex, dasSample.Points, dasSample.Proof); err != nil {
+			return stats.reject("bad_proof")
+		}
+		// a concurrent validation of the same sample may have been first
+		if !n.seenSamples.add(key, dasSample.Slot) {
+			return stats.ignore("duplicate")
+		}
+		msg.ValidatorData = &validatedSample{sample: dasSample, data: data, header: header}
+		return stats.accept()
 	}
 }
 
 func (n *Eth2Node) vertHandleSubnet(index VerticalIndex, sub *pubsub.Subscription) {
-	{
+	for {
 		msg, err := sub.Next(n.subProcesses.ctx)
 		if err != nil {
 			if err == n.subProcesses.ctx.Err() {
@@ -29,9 +133,18 @@ func (n *Eth2Node) vertHandleSubnet(index VerticalIndex, sub *pubsub.Subscriptio
 			return
 		}
 		if msg.ReceivedFrom == n.h.ID() { // ignore our own messages
-			return
+			continue
 		}
+		n.sink.OnMessage(n.conf.VertTopic(index), msg)
 		n.log.With("from", msg.ReceivedFrom, "index", index, "length", len(msg.Data)).Debug("received vert message")
-		// TODO verify that what we got is correct
+		validated, ok := msg.ValidatorData.(*validatedSample)
+		if !ok {
+			n.log.With("subnet", index).Error("validated DAS sample message without validator data")
+			continue
+		}
+		dasSample := validated.sample
+		n.availability.addSample(dasSample.Slot, dasSample.ShardHeaderRoot, dasSample.SampleIndex, SampleReceipt{At: time.Now()})
+		n.repairSample(dasSample.ShardHeaderRoot, validated.header, dasSample.SampleIndex, dasSample.Points)
+		n.storeSample(dasSample, validated.data)
 	}
 }
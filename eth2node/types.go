@@ -1,14 +1,60 @@
 package eth2node
 
 import (
+	"bytes"
+	"fmt"
 	verkle "github.com/protolambda/go-verkle"
 	"github.com/protolambda/zrnt/eth2/beacon"
 	"github.com/protolambda/ztyp/codec"
 	"github.com/protolambda/ztyp/tree"
+	"github.com/protolambda/ztyp/view"
 )
 
 type VerticalIndex uint64
 
+func (i *VerticalIndex) Deserialize(dr *codec.DecodingReader) error {
+	return (*view.Uint64View)(i).Deserialize(dr)
+}
+
+func (i VerticalIndex) Serialize(w *codec.EncodingWriter) error {
+	return w.WriteUint64(uint64(i))
+}
+
+func (VerticalIndex) ByteLength() uint64 {
+	return 8
+}
+
+func (VerticalIndex) FixedLength() uint64 {
+	return 8
+}
+
+func (i VerticalIndex) HashTreeRoot(hFn tree.HashFn) Root {
+	return view.Uint64View(i).HashTreeRoot(hFn)
+}
+
+// SampleIndex is the index of a sample within the extended data of a shard block
+type SampleIndex uint64
+
+func (i *SampleIndex) Deserialize(dr *codec.DecodingReader) error {
+	return (*view.Uint64View)(i).Deserialize(dr)
+}
+
+func (i SampleIndex) Serialize(w *codec.EncodingWriter) error {
+	return w.WriteUint64(uint64(i))
+}
+
+func (SampleIndex) ByteLength() uint64 {
+	return 8
+}
+
+func (SampleIndex) FixedLength() uint64 {
+	return 8
+}
+
+func (i SampleIndex) HashTreeRoot(hFn tree.HashFn) Root {
+	return view.Uint64View(i).HashTreeRoot(hFn)
+}
+
 // Aliases for ease of use
 type ValidatorIndex = beacon.ValidatorIndex
 type Root = beacon.Root
@@ -81,26 +127,28 @@ type ShardBlockHeader struct {
 	Shard            Shard
 	ProposerIndex    ValidatorIndex
 	BodyRoot         Root
+	// Kate commitment to the extended body data
+	BodyCommitment KateCommitment
 }
 
 func (d *ShardBlockHeader) Deserialize(dr *codec.DecodingReader) error {
-	return dr.FixedLenContainer(&d.ShardParentRoot, &d.BeaconParentRoot, &d.Slot, &d.Shard, &d.ProposerIndex, &d.BodyRoot)
+	return dr.FixedLenContainer(&d.ShardParentRoot, &d.BeaconParentRoot, &d.Slot, &d.Shard, &d.ProposerIndex, &d.BodyRoot, &d.BodyCommitment)
 }
 
 func (d *ShardBlockHeader) Serialize(w *codec.EncodingWriter) error {
-	return w.FixedLenContainer(&d.ShardParentRoot, &d.BeaconParentRoot, &d.Slot, &d.Shard, &d.ProposerIndex, &d.BodyRoot)
+	return w.FixedLenContainer(&d.ShardParentRoot, &d.BeaconParentRoot, &d.Slot, &d.Shard, &d.ProposerIndex, &d.BodyRoot, &d.BodyCommitment)
 }
 
 func (d *ShardBlockHeader) ByteLength() uint64 {
-	return codec.ContainerLength(&d.ShardParentRoot, &d.BeaconParentRoot, &d.Slot, &d.Shard, &d.ProposerIndex, &d.BodyRoot)
+	return codec.ContainerLength(&d.ShardParentRoot, &d.BeaconParentRoot, &d.Slot, &d.Shard, &d.ProposerIndex, &d.BodyRoot, &d.BodyCommitment)
 }
 
 func (d *ShardBlockHeader) FixedLength() uint64 {
-	return codec.ContainerLength(&d.ShardParentRoot, &d.BeaconParentRoot, &d.Slot, &d.Shard, &d.ProposerIndex, &d.BodyRoot)
+	return codec.ContainerLength(&d.ShardParentRoot, &d.BeaconParentRoot, &d.Slot, &d.Shard, &d.ProposerIndex, &d.BodyRoot, &d.BodyCommitment)
 }
 
 func (d *ShardBlockHeader) HashTreeRoot(hFn tree.HashFn) Root {
-	return hFn.HashTreeRoot(&d.ShardParentRoot, &d.BeaconParentRoot, &d.Slot, &d.Shard, &d.ProposerIndex, &d.BodyRoot)
+	return hFn.HashTreeRoot(&d.ShardParentRoot, &d.BeaconParentRoot, &d.Slot, &d.Shard, &d.ProposerIndex, &d.BodyRoot, &d.BodyCommitment)
 }
 
 type SignedShardBlockHeader struct {
@@ -153,14 +201,12 @@ func (d *ShardBlockData) HashTreeRoot(hFn tree.HashFn) Root {
 	return hFn.ByteListHTR(*d, blockDataLimit)
 }
 
-// TODO
-const sampleByteLength = 1 << 20
-
 // TODO naming
+// The length of a chunk depends on the config (POINTS_PER_SAMPLE), it must be allocated before decoding into it.
 type ShardBlockDataChunk []byte
 
 func (d *ShardBlockDataChunk) Deserialize(dr *codec.DecodingReader) error {
-	return dr.ByteVector((*[]byte)(d), sampleByteLength)
+	return dr.ByteVector((*[]byte)(d), uint64(len(*d)))
 }
 
 func (d *ShardBlockDataChunk) Serialize(w *codec.EncodingWriter) error {
@@ -179,34 +225,66 @@ func (d *ShardBlockDataChunk) HashTreeRoot(hFn tree.HashFn) Root {
 	return hFn.ByteVectorHTR(*d)
 }
 
-type DASMessage struct {
+// DASSample is a sample of a shard block, as published on a vertical subnet, and as served on request.
+type DASSample struct {
 	Slot  Slot
-	Chunk ShardBlockDataChunk
-	Index VerticalIndex
-
-	// TODO: does this need a ref to the shard block root, so it can be matched with the header easily?
+	Shard Shard
+	// Index of the sample in the shard block, the vertical subnet is derived from the slot, shard and sample index.
+	SampleIndex SampleIndex
+	// Root of the shard header, to match the sample with, and verify the proof against.
 	ShardHeaderRoot Root
+	// POINTS_PER_SAMPLE points, of BYTES_PER_FULL_POINT bytes each.
+	Points ShardBlockDataChunk
+	// Proof to show that the points are part of the commitment in the header.
+	Proof KateProof
+}
+
+func (d *DASSample) Deserialize(dr *codec.DecodingReader) error {
+	return dr.FixedLenContainer(&d.Slot, &d.Shard, &d.SampleIndex, &d.ShardHeaderRoot, &d.Points, &d.Proof)
+}
+
+func (d *DASSample) Serialize(w *codec.EncodingWriter) error {
+	return w.FixedLenContainer(&d.Slot, &d.Shard, &d.SampleIndex, &d.ShardHeaderRoot, &d.Points, &d.Proof)
+}
+
+func (d *DASSample) ByteLength() uint64 {
+	return codec.ContainerLength(&d.Slot, &d.Shard, &d.SampleIndex, &d.ShardHeaderRoot, &d.Points, &d.Proof)
+}
 
-	// Proof to show that the chunk is part of the vector commitment in the header.
-	KateProof beacon.BLSPubkey
+func (d *DASSample) FixedLength() uint64 {
+	return codec.ContainerLength(&d.Slot, &d.Shard, &d.SampleIndex, &d.ShardHeaderRoot, &d.Points, &d.Proof)
 }
 
-func (d *DASMessage) Deserialize(dr *codec.DecodingReader) error {
-	return dr.FixedLenContainer(&d.Slot, &d.Chunk, &d.ShardHeaderRoot, &d.KateProof)
+func (d *DASSample) HashTreeRoot(hFn tree.HashFn) Root {
+	return hFn.HashTreeRoot(&d.Slot, &d.Shard, &d.SampleIndex, &d.ShardHeaderRoot, &d.Points, &d.Proof)
 }
 
-func (d *DASMessage) Serialize(w *codec.EncodingWriter) error {
-	return w.FixedLenContainer(&d.Slot, &d.Chunk, &d.ShardHeaderRoot, &d.KateProof)
+// newDASSample allocates the points of a sample, so it can be decoded into.
+// The points are a fixed-length vector, the length depends on the config.
+func (conf *ExpandedConfig) newDASSample() *DASSample {
+	return &DASSample{
+		Points: make(ShardBlockDataChunk, conf.POINTS_PER_SAMPLE*BYTES_PER_FULL_POINT),
+	}
 }
 
-func (d *DASMessage) ByteLength() uint64 {
-	return codec.ContainerLength(&d.Slot, &d.Chunk, &d.ShardHeaderRoot, &d.KateProof)
+// DASSampleLength is the byte length of an encoded DAS sample, which depends on the sample size of the config.
+func (conf *ExpandedConfig) DASSampleLength() uint64 {
+	return conf.newDASSample().FixedLength()
 }
 
-func (d *DASMessage) FixedLength() uint64 {
-	return codec.ContainerLength(&d.Slot, &d.Chunk, &d.ShardHeaderRoot, &d.KateProof)
+// SignedShardBlockMaxLength is the maximum byte length of an encoded signed shard block, with MAX_DATA_SIZE data.
+func (conf *ExpandedConfig) SignedShardBlockMaxLength() uint64 {
+	return (&SignedShardBlock{}).ByteLength() + conf.MAX_DATA_SIZE
 }
 
-func (d *DASMessage) HashTreeRoot(hFn tree.HashFn) Root {
-	return hFn.HashTreeRoot(&d.Slot, &d.Chunk, &d.ShardHeaderRoot, &d.KateProof)
+// DecodeDASSample decodes a DAS sample, with the sample size of the config.
+func (conf *ExpandedConfig) DecodeDASSample(data []byte) (*DASSample, error) {
+	sample := conf.newDASSample()
+	if expected := sample.FixedLength(); uint64(len(data)) != expected {
+		return nil, fmt.Errorf("unexpected DAS sample length %d, expected %d", len(data), expected)
+	}
+	if err := sample.Deserialize(codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data)))); err != nil {
+		return nil, err
+	}
+	return sample, nil
 }
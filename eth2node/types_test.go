@@ -0,0 +1,92 @@
+package eth2node
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+type hexBytes []byte
+
+func (b *hexBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	out, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return err
+	}
+	*b = out
+	return nil
+}
+
+// Test vectors generated by testdata/gen_das_sample_vectors.py
+type dasSampleVector struct {
+	Name            string   `json:"name"`
+	PointsPerSample uint64   `json:"points_per_sample"`
+	Slot            uint64   `json:"slot"`
+	Shard           uint64   `json:"shard"`
+	SampleIndex     uint64   `json:"sample_index"`
+	ShardHeaderRoot hexBytes `json:"shard_header_root"`
+	Points          hexBytes `json:"points"`
+	Proof           hexBytes `json:"proof"`
+	Serialized      hexBytes `json:"serialized"`
+	Root            hexBytes `json:"root"`
+}
+
+func TestDASSampleVectors(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/das_sample_vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []dasSampleVector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range vectors {
+		t.Run(v.Name, func(t *testing.T) {
+			conf := (&Config{POINTS_PER_SAMPLE: v.PointsPerSample}).Expand()
+			expected := DASSample{
+				Slot:        Slot(v.Slot),
+				Shard:       Shard(v.Shard),
+				SampleIndex: SampleIndex(v.SampleIndex),
+				Points:      ShardBlockDataChunk(v.Points),
+			}
+			copy(expected.ShardHeaderRoot[:], v.ShardHeaderRoot)
+			copy(expected.Proof[:], v.Proof)
+
+			if l := conf.DASSampleLength(); l != uint64(len(v.Serialized)) {
+				t.Fatalf("expected length %d, got %d", len(v.Serialized), l)
+			}
+			var buf bytes.Buffer
+			if err := expected.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), v.Serialized) {
+				t.Fatalf("serialized mismatch:\n%x\n%x", buf.Bytes(), []byte(v.Serialized))
+			}
+			if root := expected.HashTreeRoot(tree.GetHashFn()); !bytes.Equal(root[:], v.Root) {
+				t.Fatalf("root mismatch: %x <> %x", root[:], []byte(v.Root))
+			}
+
+			decoded, err := conf.DecodeDASSample(v.Serialized)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Slot != expected.Slot || decoded.Shard != expected.Shard || decoded.SampleIndex != expected.SampleIndex ||
+				decoded.ShardHeaderRoot != expected.ShardHeaderRoot || decoded.Proof != expected.Proof ||
+				!bytes.Equal(decoded.Points, expected.Points) {
+				t.Fatalf("decoded sample does not match: %v", decoded)
+			}
+			if _, err := conf.DecodeDASSample(v.Serialized[:len(v.Serialized)-1]); err == nil {
+				t.Fatal("expected truncated sample to fail decoding")
+			}
+		})
+	}
+}
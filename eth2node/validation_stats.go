@@ -0,0 +1,50 @@
+package eth2node
+
+import (
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"sync"
+)
+
+// ValidationStats counts the outcomes of gossip validation of a topic type, by reason.
+type ValidationStats struct {
+	sync.Mutex
+	counts map[string]uint64
+}
+
+func newValidationStats() *ValidationStats {
+	return &ValidationStats{counts: make(map[string]uint64)}
+}
+
+func (s *ValidationStats) inc(reason string) {
+	s.Lock()
+	s.counts[reason] += 1
+	s.Unlock()
+}
+
+// accept, ignore and reject count the reason, and return the corresponding validation result.
+
+func (s *ValidationStats) accept() pubsub.ValidationResult {
+	s.inc("accept")
+	return pubsub.ValidationAccept
+}
+
+func (s *ValidationStats) ignore(reason string) pubsub.ValidationResult {
+	s.inc("ignore_" + reason)
+	return pubsub.ValidationIgnore
+}
+
+func (s *ValidationStats) reject(reason string) pubsub.ValidationResult {
+	s.inc("reject_" + reason)
+	return pubsub.ValidationReject
+}
+
+// Snapshot copies the current counts, keyed by "accept", or "ignore_<reason>" and "reject_<reason>".
+func (s *ValidationStats) Snapshot() map[string]uint64 {
+	s.Lock()
+	defer s.Unlock()
+	out := make(map[string]uint64, len(s.counts))
+	for k, v := range s.counts {
+		out[k] = v
+	}
+	return out
+}
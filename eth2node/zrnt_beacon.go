@@ -0,0 +1,124 @@
+package eth2node
+
+import (
+	"context"
+	"fmt"
+	"github.com/protolambda/zrnt/eth2/beacon"
+	"sync"
+)
+
+// Like phase 1: the domain type of the shard committee seed.
+var DOMAIN_SHARD_COMMITTEE = beacon.BLSDomainType{0x81, 0x00, 0x00, 0x00}
+
+type zrntEpoch struct {
+	seed   Root
+	active []ValidatorIndex
+}
+
+// ZrntBeaconView runs the zrnt beacon state transition to provide the beacon chain data.
+// No blocks are processed, only empty slots: the state is moved forward as later epochs and slots are requested.
+// The data of past epochs is kept, past block roots are available as far as the state history goes back.
+type ZrntBeaconView struct {
+	sync.Mutex
+	spec   *beacon.Spec
+	epc    *beacon.EpochsContext
+	state  *beacon.BeaconStateView
+	epochs map[Epoch]*zrntEpoch
+}
+
+// NewZrntBeaconView starts a beacon view from the given state, e.g. a genesis state.
+func NewZrntBeaconView(spec *beacon.Spec, state *beacon.BeaconStateView) (*ZrntBeaconView, error) {
+	epc, err := spec.NewEpochsContext(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create epochs context: %v", err)
+	}
+	v := &ZrntBeaconView{spec: spec, epc: epc, state: state, epochs: make(map[Epoch]*zrntEpoch)}
+	if err := v.recordEpoch(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// recordEpoch keeps the data of the current epoch of the state, before the state transitions past it.
+func (v *ZrntBeaconView) recordEpoch() error {
+	epoch := v.epc.CurrentEpoch.Epoch
+	if _, ok := v.epochs[epoch]; ok {
+		return nil
+	}
+	mixes, err := v.state.RandaoMixes()
+	if err != nil {
+		return err
+	}
+	seed, err := v.spec.GetSeed(mixes, epoch, DOMAIN_SHARD_COMMITTEE)
+	if err != nil {
+		return fmt.Errorf("failed to compute seed of epoch %d: %v", epoch, err)
+	}
+	active := make([]ValidatorIndex, len(v.epc.CurrentEpoch.ActiveIndices))
+	copy(active, v.epc.CurrentEpoch.ActiveIndices)
+	v.epochs[epoch] = &zrntEpoch{seed: seed, active: active}
+	return nil
+}
+
+// processUntil runs the state transition, through empty slots, until the state is at the given slot.
+// The data of each epoch is recorded along the way.
+func (v *ZrntBeaconView) processUntil(slot Slot) error {
+	for {
+		current, err := v.state.Slot()
+		if err != nil {
+			return err
+		}
+		if current >= slot {
+			return nil
+		}
+		// stop at every epoch boundary, to record the epoch data
+		next := (current/v.spec.SLOTS_PER_EPOCH + 1) * v.spec.SLOTS_PER_EPOCH
+		if next > slot {
+			next = slot
+		}
+		if err := v.spec.ProcessSlots(context.Background(), v.epc, v.state, next); err != nil {
+			return fmt.Errorf("failed to process slots up to %d: %v", next, err)
+		}
+		if err := v.recordEpoch(); err != nil {
+			return err
+		}
+	}
+}
+
+func (v *ZrntBeaconView) epoch(epoch Epoch) (*zrntEpoch, error) {
+	v.Lock()
+	defer v.Unlock()
+	if err := v.processUntil(v.spec.EpochStartSlot(epoch)); err != nil {
+		return nil, err
+	}
+	data, ok := v.epochs[epoch]
+	if !ok {
+		return nil, fmt.Errorf("epoch %d is before the start of the beacon view", epoch)
+	}
+	return data, nil
+}
+
+func (v *ZrntBeaconView) Seed(epoch Epoch) (Root, error) {
+	data, err := v.epoch(epoch)
+	if err != nil {
+		return Root{}, err
+	}
+	return data.seed, nil
+}
+
+func (v *ZrntBeaconView) BlockRoot(slot Slot) (Root, error) {
+	v.Lock()
+	defer v.Unlock()
+	// The block root of a slot is put in the state history when transitioning to the next slot.
+	if err := v.processUntil(slot + 1); err != nil {
+		return Root{}, err
+	}
+	return v.spec.GetBlockRootAtSlot(v.state, slot)
+}
+
+func (v *ZrntBeaconView) ActiveValidators(epoch Epoch) ([]ValidatorIndex, error) {
+	data, err := v.epoch(epoch)
+	if err != nil {
+		return nil, err
+	}
+	return data.active, nil
+}
@@ -2,8 +2,6 @@ package main
 
 import (
 	"context"
-	"github.com/libp2p/go-libp2p-core/peer"
-	ma "github.com/multiformats/go-multiaddr"
 	"github.com/pkg/errors"
 	"github.com/protolambda/eth2-das/eth2node"
 	"github.com/protolambda/zrnt/eth2/beacon"
@@ -32,8 +30,10 @@ func das(runenv *runtime.RunEnv, initCtx *run.InitContext) error {
 		SLOTS_PER_FAST_ROTATION_MAX: 32,
 		SLOTS_PER_SLOW_ROTATION:     2048,
 		SLOT_OFFSET_PER_SLOW_INDEX:  512,
+		SLOW_SUBNET_LOOKAHEAD_SLOTS: 32,
 		SHARD_COUNT:                 64,
 		SECONDS_PER_SLOT:            12,
+		SLOTS_PER_EPOCH:             32,
 		VALIDATOR_COUNT:             150000,
 		ForkDigest:                  [4]byte{0xaa, 0xbb, 0xcc, 0xdd},
 		TARGET_PEERS_PER_DAS_SUB:    6,
@@ -41,6 +41,17 @@ func das(runenv *runtime.RunEnv, initCtx *run.InitContext) error {
 		PEER_COUNT_HI:               200,
 		GENESIS_TIME:                uint64(time.Now().Unix()), // TODO
 		SHUFFLE_ROUND_COUNT:         90,
+		SHARD_COMMITTEE_PERIOD:      1, // short, to simulate the churn of committee rotations
+		HORZ_SUBNET_LOOKAHEAD_SLOTS: 8,
+		PULL_DEADLINE:               time.Second * 4,
+		PULL_PEERS:                  3,
+		AVAILABILITY_DEADLINE:       time.Second * 8,
+		MIN_SUBNET_AGE_SLOTS:        1,
+		// serve samples of the last few epochs, from memory
+		SAMPLE_STORE_RETENTION_SLOTS: 64,
+		// only used by nodes that enable the repairer
+		REPAIR_FRACTION: 0.75,
+		REPAIR_DELAY:    time.Second * 2,
 		// TODO gossipsub score tuning (ignored for now)
 		VERT_SUBNET_TOPIC_SCORE_PARAMS:   nil,
 		HORZ_SUBNET_TOPIC_SCORE_PARAMS:   nil,
@@ -48,18 +59,16 @@ func das(runenv *runtime.RunEnv, initCtx *run.InitContext) error {
 		GOSSIP_GLOBAL_SCORE_PARAMS:       nil,
 		GOSSIP_GLOBAL_SCORE_THRESHOLDS:   nil,
 	}
-	// TODO: use Testground sync to learn all peer IDs and their addresses
-	disc := &eth2node.MockDiscovery{
-		Peers: make(map[peer.ID][]ma.Multiaddr),
-	}
-	n, err := eth2node.New(ctx, conf, disc, runenv.SLogger())
+	// learn all peer IDs and their addresses through the Testground sync service
+	disc := eth2node.NewSyncDiscovery(&testgroundSync{client: initCtx.SyncClient})
+	beaconView := &eth2node.MockBeaconView{ValidatorCount: conf.VALIDATOR_COUNT}
+	n, err := eth2node.New(ctx, conf, disc, beaconView, runenv.SLogger())
 	if err != nil {
 		return errors.Wrap(err, "failed to start eth2 node")
 	}
 
 	// Select a subset of validators based on global sequence number of this node.
-	// (TODO: alternatively use testground comms)
-	nodeCount := uint64(100)
+	nodeCount := uint64(runenv.TestInstanceCount)
 	start := conf.VALIDATOR_COUNT * uint64(initCtx.GlobalSeq) / nodeCount
 	end := conf.VALIDATOR_COUNT * uint64(initCtx.GlobalSeq+1) / nodeCount
 	count := end - start
@@ -67,13 +76,18 @@ func das(runenv *runtime.RunEnv, initCtx *run.InitContext) error {
 	for i := uint64(0); i < count; i++ {
 		indices[i] = beacon.ValidatorIndex(start + i)
 	}
-	// TODO: generate interop BLS keys for validators maybe?
+	// validators sign with the interop BLS key of their index, see eth2node.InteropSecretKey
 	n.RegisterValidators(indices...)
 
 	if err := n.Start(net.IPv4zero, 9000); err != nil {
 		return errors.Wrap(err, "failed to start node")
 	}
 
+	id, addrs := n.DiscInfo()
+	if err := disc.Join(ctx, eth2node.NewDiscRecord(id, addrs, conf.SLOW_INDICES, indices), runenv.TestInstanceCount); err != nil {
+		return errors.Wrap(err, "failed to join discovery")
+	}
+
 	// TODO configure test time
 	time.Sleep(time.Minute * 10)
 
@@ -3,8 +3,6 @@ package main
 import (
 	"context"
 	"fmt"
-	"github.com/libp2p/go-libp2p-core/peer"
-	ma "github.com/multiformats/go-multiaddr"
 	"github.com/pkg/errors"
 	"github.com/protolambda/eth2-das/eth2node"
 	"github.com/protolambda/zrnt/eth2/beacon"
@@ -25,8 +23,10 @@ func TestDAS(t *testing.T) {
 		SLOTS_PER_FAST_ROTATION_MAX: 32,
 		SLOTS_PER_SLOW_ROTATION:     2048,
 		SLOT_OFFSET_PER_SLOW_INDEX:  512,
+		SLOW_SUBNET_LOOKAHEAD_SLOTS: 32,
 		SHARD_COUNT:                 4, // smaller, just testing here, lower resources.
 		SECONDS_PER_SLOT:            12,
+		SLOTS_PER_EPOCH:             32,
 		VALIDATOR_COUNT:             1500, // TODO
 		ForkDigest:                  [4]byte{0xaa, 0xbb, 0xcc, 0xdd},
 		TARGET_PEERS_PER_DAS_SUB:    6,
@@ -34,6 +34,17 @@ func TestDAS(t *testing.T) {
 		PEER_COUNT_HI:               200,
 		GENESIS_TIME:                uint64(time.Now().Add(time.Second * 40).Unix()), // TODO
 		SHUFFLE_ROUND_COUNT:         90,
+		SHARD_COMMITTEE_PERIOD:      1, // short, to simulate the churn of committee rotations
+		HORZ_SUBNET_LOOKAHEAD_SLOTS: 8,
+		PULL_DEADLINE:               time.Second * 4,
+		PULL_PEERS:                  3,
+		AVAILABILITY_DEADLINE:       time.Second * 8,
+		MIN_SUBNET_AGE_SLOTS:        1,
+		// serve samples of the last few epochs, from memory
+		SAMPLE_STORE_RETENTION_SLOTS: 64,
+		// only used by nodes that enable the repairer
+		REPAIR_FRACTION: 0.75,
+		REPAIR_DELAY:    time.Second * 2,
 		// TODO gossipsub score tuning (ignored for now)
 		VERT_SUBNET_TOPIC_SCORE_PARAMS:   nil,
 		HORZ_SUBNET_TOPIC_SCORE_PARAMS:   nil,
@@ -44,7 +55,6 @@ func TestDAS(t *testing.T) {
 		ENABLE_NAT:                 false,
 		DISABLE_TRANSPORT_SECURITY: true,
 	}
-	// TODO: use Testground sync to learn all peer IDs and their addresses
 
 	log, err := zap.NewDevelopment()
 	if err != nil {
@@ -52,16 +62,29 @@ func TestDAS(t *testing.T) {
 	}
 	slog := log.Sugar()
 	nodeCount := uint64(128)
-	disc := &eth2node.MockDiscovery{
-		Peers: make(map[peer.ID][]ma.Multiaddr),
+	repairerCount := uint64(4)
+	// a few high-capacity nodes are publicly subscribed to many more subnets, as part of the backbone
+	superNodeCount := uint64(4)
+	superNodeConf := *conf
+	superNodeConf.SLOW_INDICES = 32
+	nodeConf := func(nodeIndex uint64) *eth2node.Config {
+		if nodeIndex >= nodeCount-superNodeCount {
+			return &superNodeConf
+		}
+		return conf
 	}
+	// the nodes learn all peer IDs and their addresses through a local stand-in of the Testground sync service
+	syncService := eth2node.NewMemorySyncService()
+	// all nodes share the same mock beacon chain
+	beaconView := &eth2node.MockBeaconView{ValidatorCount: conf.VALIDATOR_COUNT}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	mkNode := func(nodeIndex uint64) (*eth2node.Eth2Node, error) {
-		n, err := eth2node.New(ctx, conf, disc, slog.With("node", nodeIndex))
+	mkNode := func(nodeIndex uint64) (*eth2node.Eth2Node, *eth2node.SyncDiscovery, error) {
+		disc := eth2node.NewSyncDiscovery(syncService)
+		n, err := eth2node.New(ctx, nodeConf(nodeIndex), disc, beaconView, slog.With("node", nodeIndex))
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to start eth2 node")
+			return nil, nil, errors.Wrap(err, "failed to start eth2 node")
 		}
 		start := conf.VALIDATOR_COUNT * nodeIndex / nodeCount
 		end := conf.VALIDATOR_COUNT * (nodeIndex + 1) / nodeCount
@@ -70,26 +93,47 @@ func TestDAS(t *testing.T) {
 		for i := uint64(0); i < count; i++ {
 			indices[i] = beacon.ValidatorIndex(start + i)
 		}
-		// TODO: generate interop BLS keys for validators maybe?
+		// validators sign with the interop BLS key of their index, see eth2node.InteropSecretKey
 		n.RegisterValidators(indices...)
+		// a few nodes recover and republish missing samples of all shards
+		if nodeIndex < repairerCount {
+			shards := make([]beacon.Shard, conf.SHARD_COUNT)
+			for i := range shards {
+				shards[i] = beacon.Shard(i)
+			}
+			if err := n.EnableRepairer(shards...); err != nil {
+				return nil, nil, errors.Wrap(err, "failed to enable repairer")
+			}
+		}
 		if err := n.Start(net.IPv4zero, 9000+uint16(nodeIndex)); err != nil {
-			return nil, errors.Wrap(err, "failed to start node")
+			return nil, nil, errors.Wrap(err, "failed to start node")
 		}
-		return n, nil
+		return n, disc, nil
 	}
 
 	var nodes []*eth2node.Eth2Node
+	var discs []*eth2node.SyncDiscovery
 	for i := uint64(0); i < nodeCount; i++ {
-		n, err := mkNode(i)
+		n, disc, err := mkNode(i)
 		if err != nil {
 			t.Fatalf("node %d failed to start: %v", i, err)
 		}
 		nodes = append(nodes, n)
+		discs = append(discs, disc)
 	}
 
-	for _, n := range nodes {
-		id, addrs := n.DiscInfo()
-		disc.Peers[id] = addrs
+	// every node joins discovery, this waits for all nodes to publish their record
+	joinErrs := make(chan error, nodeCount)
+	for i, n := range nodes {
+		go func(n *eth2node.Eth2Node, disc *eth2node.SyncDiscovery, slowIndices uint64) {
+			id, addrs := n.DiscInfo()
+			joinErrs <- disc.Join(ctx, eth2node.NewDiscRecord(id, addrs, slowIndices, n.ListValidators()), int(nodeCount))
+		}(n, discs[i], nodeConf(uint64(i)).SLOW_INDICES)
+	}
+	for range nodes {
+		if err := <-joinErrs; err != nil {
+			t.Fatal(err)
+		}
 	}
 
 	// Log useful global information in slot loop, avoid logging duplicate info on each peer.
@@ -110,7 +154,7 @@ func TestDAS(t *testing.T) {
 					slog.With("genesis_time", conf.GENESIS_TIME, "slots", slot).Info("Genesis countdown...")
 					continue
 				}
-				backbone := disc.FindPublic(&expConf, slot, allSubnets)
+				backbone := discs[0].FindPublic(&expConf, slot, allSubnets)
 				var slotsStats strings.Builder
 				slotsStats.WriteString("backbone:\n")
 				for i := eth2node.VerticalIndex(0); i < eth2node.VerticalIndex(expConf.SAMPLE_SUBNETS); i++ {
@@ -121,6 +165,11 @@ func TestDAS(t *testing.T) {
 					peerCount := node.Stats()
 					slotsStats.WriteString(fmt.Sprintf("%3d ", peerCount))
 				}
+				slotsStats.WriteString("\nunder-peered slow subnet switches:\n")
+				for _, node := range nodes {
+					switchStats := node.SlowSwitchStats()
+					slotsStats.WriteString(fmt.Sprintf("%d/%d ", switchStats.UnderPeered, switchStats.Switches))
+				}
 				slog.With("slot", slot).Debug(slotsStats.String())
 			case <-ctx.Done():
 				return
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"github.com/protolambda/eth2-das/eth2node"
+	"github.com/testground/sdk-go/sync"
+)
+
+var discRecordsTopic = sync.NewTopic("disc_records", &eth2node.DiscRecord{})
+
+// testgroundSync shares the discovery records through the Testground sync service
+type testgroundSync struct {
+	client sync.Client
+}
+
+func (t *testgroundSync) PublishRecord(ctx context.Context, rec *eth2node.DiscRecord) error {
+	_, err := t.client.Publish(ctx, discRecordsTopic, rec)
+	return err
+}
+
+func (t *testgroundSync) SubscribeRecords(ctx context.Context) (<-chan *eth2node.DiscRecord, error) {
+	ch := make(chan *eth2node.DiscRecord)
+	if _, err := t.client.Subscribe(ctx, discRecordsTopic, ch); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+func (t *testgroundSync) SignalAndWait(ctx context.Context, state string, target int) error {
+	_, err := t.client.SignalAndWait(ctx, sync.State(state), target)
+	return err
+}